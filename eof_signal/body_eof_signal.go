@@ -3,7 +3,10 @@ package eofsignal
 import (
 	"errors"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // bodyEOFSignal is used by the HTTP/1 transport when reading response
@@ -15,26 +18,72 @@ import (
 // returns. fn should return the new error to return from Read or Close.
 //
 // If earlyCloseFn is non-nil and Close is called before io.EOF is
-// seen, earlyCloseFn is called instead of fn, and its return value is
-// the return value from Close.
+// seen, earlyCloseFn is called instead of fn. Close returns its error if
+// non-nil, and otherwise the error from closing the wrapped body.
+//
+// Unlike in net/http, the wrapped body is closed on every Close, whether
+// or not io.EOF was seen.
 type bodyEOFSignal struct {
-	body   io.ReadCloser
-	mu     sync.Mutex        // guards following 4 fields
-	closed bool              // whether Close has been called
-	rerr   error             // sticky Read error
-	fn     func(error) error // err will be nil on Read io.EOF
-	// earlyCloseFn func() error      // optional alt Close func used if io.EOF not seen
+	body         io.ReadCloser
+	mu           sync.Mutex        // guards following 6 fields
+	closed       bool              // whether Close has been called
+	rerr         error             // sticky Read error
+	fn           func(error) error // err will be nil on Read io.EOF
+	earlyCloseFn func() error      // optional alt Close func used if io.EOF not seen
+	doneErr      error             // returned by Err once done is closed
+
+	done chan struct{}
+
+	stallTimeout time.Duration
+	stalled      atomic.Bool
+	closeOnce    sync.Once
+	closeErr     error
+}
+
+// BodyOption configures a bodyEOFSignal.
+type BodyOption func(*bodyEOFSignal)
+
+// WithEarlyCloseFn sets a callback run instead of fn when the body is
+// closed before io.EOF was seen, i.e. when it was abandoned rather than
+// fully consumed.
+func WithEarlyCloseFn(fn func() error) BodyOption {
+	return func(es *bodyEOFSignal) {
+		es.earlyCloseFn = fn
+	}
+}
+
+// WithReadStallTimeout fails a Read with ErrReadStalled if no bytes arrive
+// for d. The wrapped body is closed to unblock the pending Read.
+func WithReadStallTimeout(d time.Duration) BodyOption {
+	return func(es *bodyEOFSignal) {
+		es.stallTimeout = d
+	}
 }
 
-func NewBodyEOFSignal(body io.ReadCloser, fn func(error) error) *bodyEOFSignal {
-	return &bodyEOFSignal{
+func NewBodyEOFSignal(body io.ReadCloser, fn func(error) error, opts ...BodyOption) *bodyEOFSignal {
+	es := &bodyEOFSignal{
 		body: body,
 		fn:   fn,
+		done: make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(es)
+	}
+	return es
 }
 
 var errReadOnClosedResBody = errors.New("http: read on closed response body")
 
+// ErrReadStalled is returned by reads that received no bytes within the
+// configured stall timeout. Its Timeout method reports true.
+var ErrReadStalled net.Error = stallError{}
+
+type stallError struct{}
+
+func (stallError) Error() string   { return "eofsignal: read stalled" }
+func (stallError) Timeout() bool   { return true }
+func (stallError) Temporary() bool { return true }
+
 func (es *bodyEOFSignal) Read(p []byte) (n int, err error) {
 	es.mu.Lock()
 	closed, rerr := es.closed, es.rerr
@@ -46,13 +95,14 @@ func (es *bodyEOFSignal) Read(p []byte) (n int, err error) {
 		return 0, rerr
 	}
 
-	n, err = es.body.Read(p)
+	n, err = es.readBody(p)
 	if err != nil {
 		es.mu.Lock()
 		defer es.mu.Unlock()
 		if es.rerr == nil {
 			es.rerr = err
 		}
+		es.finish(es.rerr)
 		err = es.condfn(err)
 	}
 	return
@@ -65,14 +115,71 @@ func (es *bodyEOFSignal) Close() error {
 		return nil
 	}
 	es.closed = true
-	if /*es.earlyCloseFn != nil &&*/ es.rerr != io.EOF {
-		// return es.earlyCloseFn()
-		return nil
+	err := es.closeBody()
+	es.finish(err)
+	if es.earlyCloseFn != nil && es.rerr != io.EOF {
+		if ferr := es.earlyCloseFn(); ferr != nil {
+			return ferr
+		}
+		return err
 	}
-	err := es.body.Close()
 	return es.condfn(err)
 }
 
+func (es *bodyEOFSignal) readBody(p []byte) (int, error) {
+	if es.stallTimeout <= 0 {
+		return es.body.Read(p)
+	}
+	t := time.AfterFunc(es.stallTimeout, func() {
+		es.stalled.Store(true)
+		es.closeBody()
+	})
+	n, err := es.body.Read(p)
+	if !t.Stop() && es.stalled.Load() {
+		return n, ErrReadStalled
+	}
+	return n, err
+}
+
+func (es *bodyEOFSignal) closeBody() error {
+	es.closeOnce.Do(func() {
+		es.closeErr = es.body.Close()
+	})
+	return es.closeErr
+}
+
+// Consumed reports whether the body was read until io.EOF.
+func (es *bodyEOFSignal) Consumed() bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.rerr == io.EOF
+}
+
+// Done returns a channel closed once the body hit a Read error, io.EOF
+// included, or was closed.
+func (es *bodyEOFSignal) Done() <-chan struct{} {
+	return es.done
+}
+
+// Err returns nil until Done is closed. After that it returns the first
+// Read error, io.EOF if the body was fully consumed, or else the error
+// from closing the wrapped body.
+func (es *bodyEOFSignal) Err() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.doneErr
+}
+
+// caller must hold es.mu.
+func (es *bodyEOFSignal) finish(err error) {
+	select {
+	case <-es.done:
+	default:
+		es.doneErr = err
+		close(es.done)
+	}
+}
+
 // caller must hold es.mu.
 func (es *bodyEOFSignal) condfn(err error) error {
 	if es.fn == nil {
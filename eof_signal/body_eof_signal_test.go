@@ -0,0 +1,129 @@
+package eofsignal
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testBody struct {
+	io.Reader
+	closed int
+}
+
+func (b *testBody) Close() error {
+	b.closed++
+	return nil
+}
+
+type closeErrBody struct {
+	io.Reader
+	err error
+}
+
+func (b closeErrBody) Close() error {
+	return b.err
+}
+
+var _ = Describe("bodyEOFSignal", func() {
+	var (
+		body      *testBody
+		fnCalls   []error
+		fn        = func(err error) error { fnCalls = append(fnCalls, err); return err }
+		earlyCall int
+		earlyFn   = func() error { earlyCall++; return nil }
+	)
+
+	BeforeEach(func() {
+		body = &testBody{Reader: strings.NewReader("hello")}
+		fnCalls, earlyCall = nil, 0
+	})
+
+	It("fully consumed body runs fn and closes the body", func() {
+		es := NewBodyEOFSignal(body, fn, WithEarlyCloseFn(earlyFn))
+		b, err := io.ReadAll(es)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("hello"))
+		Expect(es.Consumed()).To(BeTrue())
+		Expect(fnCalls).To(Equal([]error{io.EOF}))
+
+		Expect(es.Close()).To(Succeed())
+		Expect(body.closed).To(Equal(1))
+		Expect(earlyCall).To(BeZero())
+	})
+
+	It("abandoned body runs earlyCloseFn instead of fn and still closes the body", func() {
+		es := NewBodyEOFSignal(body, fn, WithEarlyCloseFn(earlyFn))
+		es.Read(make([]byte, 2))
+		Expect(es.Consumed()).To(BeFalse())
+
+		Expect(es.Close()).To(Succeed())
+		Expect(body.closed).To(Equal(1))
+		Expect(earlyCall).To(Equal(1))
+		Expect(fnCalls).To(BeEmpty())
+
+		Expect(es.Close()).To(Succeed())
+		Expect(body.closed).To(Equal(1))
+		_, err := es.Read(make([]byte, 2))
+		Expect(err).To(Equal(errReadOnClosedResBody))
+	})
+
+	It("abandoned body without earlyCloseFn runs fn on close", func() {
+		es := NewBodyEOFSignal(body, fn)
+		Expect(es.Close()).To(Succeed())
+		Expect(body.closed).To(Equal(1))
+		Expect(fnCalls).To(Equal([]error{nil}))
+	})
+
+	It("earlyCloseFn error is returned from Close", func() {
+		errEarly := errors.New("early")
+		es := NewBodyEOFSignal(body, fn, WithEarlyCloseFn(func() error { return errEarly }))
+		Expect(es.Close()).To(Equal(errEarly))
+		Expect(body.closed).To(Equal(1))
+	})
+
+	It("body close error is returned if earlyCloseFn succeeds", func() {
+		errBody := errors.New("body")
+		es := NewBodyEOFSignal(closeErrBody{strings.NewReader("hello"), errBody}, fn, WithEarlyCloseFn(earlyFn))
+		Expect(es.Close()).To(Equal(errBody))
+		Expect(earlyCall).To(Equal(1))
+	})
+
+	It("stalled read fails, fires fn and closes the body", func() {
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		es := NewBodyEOFSignal(pr, fn, WithReadStallTimeout(time.Millisecond*20))
+		go pw.Write([]byte("he"))
+		b := make([]byte, 8)
+		n, err := es.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b[:n])).To(Equal("he"))
+
+		_, err = es.Read(b)
+		Expect(err).To(Equal(ErrReadStalled))
+		Expect(fnCalls).To(Equal([]error{ErrReadStalled}))
+		_, err = pw.Write([]byte("x"))
+		Expect(err).To(Equal(io.ErrClosedPipe))
+		Expect(es.Close()).To(Succeed())
+	})
+
+	It("done is closed once the body is consumed or closed", func() {
+		es := NewBodyEOFSignal(body, fn)
+		Expect(es.Done()).ToNot(BeClosed())
+		Expect(es.Err()).ToNot(HaveOccurred())
+		io.ReadAll(es)
+		Expect(es.Done()).To(BeClosed())
+		Expect(es.Err()).To(Equal(io.EOF))
+		es.Close()
+		Expect(es.Err()).To(Equal(io.EOF))
+
+		es = NewBodyEOFSignal(&testBody{Reader: strings.NewReader("hello")}, nil)
+		es.Close()
+		Expect(es.Done()).To(BeClosed())
+		Expect(es.Err()).ToNot(HaveOccurred())
+	})
+})
@@ -1,50 +1,255 @@
 package eofsignal
 
 import (
+	"errors"
+	"io"
 	"net"
+	"os"
 	"sync"
+	"syscall"
+	"time"
 )
 
 var (
 	_ net.Conn = (*eofSignalConn)(nil)
 )
 
+// ErrorKind is the class of an error seen on a conn.
+type ErrorKind int
+
+const (
+	ErrorOther ErrorKind = iota
+	ErrorEOF
+	ErrorTimeout
+	ErrorReset
+	ErrorClosed
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorEOF:
+		return "eof"
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorReset:
+		return "reset"
+	case ErrorClosed:
+		return "closed"
+	default:
+		return "other"
+	}
+}
+
+// Classify returns the kind of err.
+func Classify(err error) ErrorKind {
+	var ne net.Error
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrorEOF
+	case errors.As(err, &ne) && ne.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return ErrorReset
+	case errors.Is(err, net.ErrClosed), errors.Is(err, io.ErrClosedPipe):
+		return ErrorClosed
+	default:
+		return ErrorOther
+	}
+}
+
+// defaultTerminal treats every read error as terminal except timeouts,
+// which may be retried after moving the deadline. Stalled reads stay
+// terminal as the stall timeout belongs to the conn itself.
+func defaultTerminal(err error) bool {
+	return Classify(err) != ErrorTimeout || errors.Is(err, ErrReadStalled)
+}
+
+// ConnState is the final state of an eofSignalConn.
+type ConnState struct {
+	// Terminated is set once a terminal read error was seen or the conn
+	// was closed.
+	Terminated bool
+	// Closed is set once Close was called.
+	Closed bool
+	// Cause is the first terminal cause, nil if the conn was closed
+	// locally without error.
+	Cause error
+	// Kind is the kind of a non-nil Cause.
+	Kind ErrorKind
+}
+
 type eofSignalConn struct {
 	net.Conn
 
-	mu sync.Mutex
-	fn func(error)
+	mu           sync.Mutex // guards following 3 fields
+	fn           func(error)
+	readDeadline time.Time // set by the caller
+	state        ConnState
+
+	done chan struct{} // closed once terminated
+
+	stallTimeout time.Duration
+	terminal     func(error) bool
+}
+
+// ConnOption configures an eofSignalConn.
+type ConnOption func(*eofSignalConn)
+
+// WithConnReadStallTimeout fails a Read with ErrReadStalled if no bytes
+// arrive for d, independent of any deadline set by the caller.
+func WithConnReadStallTimeout(d time.Duration) ConnOption {
+	return func(c *eofSignalConn) {
+		c.stallTimeout = d
+	}
+}
+
+// WithTerminalFunc sets which read errors are terminal. Non terminal
+// errors are returned from Read without firing the callback.
+func WithTerminalFunc(fn func(error) bool) ConnOption {
+	return func(c *eofSignalConn) {
+		c.terminal = fn
+	}
+}
+
+// WithTerminalKinds treats read errors of the given kinds as terminal.
+func WithTerminalKinds(kinds ...ErrorKind) ConnOption {
+	return WithTerminalFunc(func(err error) bool {
+		k := Classify(err)
+		for _, kind := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	})
 }
 
-func NewEOFSignalConn(conn net.Conn, fn func(error)) net.Conn {
+// NewEOFSignalConn wraps conn, calling fn exactly once with the first
+// terminal read error, or with the Close error if none was seen.
+func NewEOFSignalConn(conn net.Conn, fn func(error), opts ...ConnOption) *eofSignalConn {
 	c := &eofSignalConn{
-		Conn: conn,
-		fn:   fn,
+		Conn:     conn,
+		fn:       fn,
+		terminal: defaultTerminal,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 	return c
 }
 
 func (c *eofSignalConn) Read(p []byte) (n int, err error) {
-	n, err = c.Conn.Read(p)
-	if err != nil {
-		c.condfn(err)
+	if c.stallTimeout <= 0 {
+		n, err = c.Conn.Read(p)
+	} else {
+		n, err = c.readStall(p)
+	}
+	if err != nil && c.terminal(err) {
+		c.condfn(err, false)
+	}
+	return n, err
+}
+
+// readStall arms the stall timeout as read deadline unless the caller's
+// deadline comes first.
+func (c *eofSignalConn) readStall(p []byte) (int, error) {
+	c.mu.Lock()
+	userDeadline := c.readDeadline
+	c.mu.Unlock()
+
+	stallAt := time.Now().Add(c.stallTimeout)
+	deadline := stallAt
+	if !userDeadline.IsZero() && userDeadline.Before(stallAt) {
+		deadline = userDeadline
+	}
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) && deadline.Equal(stallAt) {
+		err = ErrReadStalled
 	}
 	return n, err
 }
 
+func (c *eofSignalConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *eofSignalConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
 func (c *eofSignalConn) Close() error {
 	err := c.Conn.Close()
-	c.condfn(err)
+	c.condfn(err, true)
 	return err
 }
 
-func (c *eofSignalConn) condfn(err error) {
+// CloseRead shuts down the reading side of the wrapped conn, if supported.
+func (c *eofSignalConn) CloseRead() error {
+	cr, ok := c.Conn.(interface{ CloseRead() error })
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	return cr.CloseRead()
+}
+
+// CloseWrite shuts down the writing side of the wrapped conn, if supported.
+func (c *eofSignalConn) CloseWrite() error {
+	cw, ok := c.Conn.(interface{ CloseWrite() error })
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	return cw.CloseWrite()
+}
+
+// State returns the conn's current state.
+func (c *eofSignalConn) State() ConnState {
 	c.mu.Lock()
-	fn := c.fn
-	if fn == nil {
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Done returns a channel closed once the conn is terminated.
+func (c *eofSignalConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the terminal cause once Done is closed, nil before that or
+// for a clean local close.
+func (c *eofSignalConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Cause
+}
+
+func (c *eofSignalConn) condfn(err error, closed bool) {
+	c.mu.Lock()
+	if closed {
+		c.state.Closed = true
+	}
+	if c.state.Terminated {
 		c.mu.Unlock()
 		return
 	}
+	c.state.Terminated = true
+	c.state.Cause = err
+	if err != nil {
+		c.state.Kind = Classify(err)
+	}
+	close(c.done)
+	fn := c.fn
+	c.fn = nil
 	c.mu.Unlock()
-	fn(err)
+	if fn != nil {
+		fn(err)
+	}
 }
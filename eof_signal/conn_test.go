@@ -0,0 +1,108 @@
+package eofsignal
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("eofSignalConn", func() {
+	var (
+		client, server net.Conn
+		causes         []error
+		fn             = func(err error) { causes = append(causes, err) }
+	)
+
+	BeforeEach(func() {
+		client, server = net.Pipe()
+		causes = nil
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Close()
+	})
+
+	It("half close is unsupported on conns without it", func() {
+		c := NewEOFSignalConn(client, fn)
+		Expect(c.CloseWrite()).To(Equal(ErrHalfCloseUnsupported))
+		Expect(c.CloseRead()).To(Equal(ErrHalfCloseUnsupported))
+		Expect(causes).To(BeEmpty())
+	})
+
+	Context("read stall timeout", func() {
+		It("fails a read receiving no bytes and fires the callback", func() {
+			c := NewEOFSignalConn(client, fn, WithConnReadStallTimeout(time.Millisecond*20))
+			go func() {
+				for i := 0; i < 3; i++ {
+					server.Write([]byte("a"))
+					time.Sleep(time.Millisecond * 10)
+				}
+			}()
+			for i := 0; i < 3; i++ {
+				_, err := c.Read(make([]byte, 1))
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err := c.Read(make([]byte, 1))
+			Expect(err).To(Equal(ErrReadStalled))
+			Expect(causes).To(Equal([]error{ErrReadStalled}))
+		})
+
+		It("an earlier caller deadline is reported as is", func() {
+			c := NewEOFSignalConn(client, fn, WithConnReadStallTimeout(time.Second))
+			c.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+			_, err := c.Read(make([]byte, 1))
+			Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+			Expect(causes).To(BeEmpty())
+		})
+	})
+
+	It("fires the callback once with the first terminal cause", func() {
+		c := NewEOFSignalConn(client, fn)
+		server.Close()
+		for i := 0; i < 2; i++ {
+			_, err := c.Read(make([]byte, 1))
+			Expect(err).To(Equal(io.EOF))
+		}
+		Expect(c.Done()).To(BeClosed())
+		Expect(c.Err()).To(Equal(io.EOF))
+		c.Close()
+		Expect(causes).To(Equal([]error{io.EOF}))
+		Expect(c.State()).To(Equal(ConnState{Terminated: true, Closed: true, Cause: io.EOF, Kind: ErrorEOF}))
+	})
+
+	It("timeouts are not terminal by default", func() {
+		c := NewEOFSignalConn(client, fn)
+		c.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+		_, err := c.Read(make([]byte, 1))
+		Expect(Classify(err)).To(Equal(ErrorTimeout))
+		Expect(c.State().Terminated).To(BeFalse())
+		Expect(c.Done()).ToNot(BeClosed())
+
+		c.Close()
+		Expect(causes).To(Equal([]error{nil}))
+		Expect(c.State()).To(Equal(ConnState{Terminated: true, Closed: true}))
+	})
+
+	It("terminal kinds are configurable", func() {
+		c := NewEOFSignalConn(client, fn, WithTerminalKinds(ErrorTimeout))
+		c.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+		_, err := c.Read(make([]byte, 1))
+		Expect(causes).To(Equal([]error{err}))
+		Expect(c.State().Kind).To(Equal(ErrorTimeout))
+	})
+
+	It("classifies errors", func() {
+		Expect(Classify(io.EOF)).To(Equal(ErrorEOF))
+		Expect(Classify(ErrReadStalled)).To(Equal(ErrorTimeout))
+		Expect(Classify(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)})).To(Equal(ErrorReset))
+		Expect(Classify(net.ErrClosed)).To(Equal(ErrorClosed))
+		Expect(Classify(errors.New("x"))).To(Equal(ErrorOther))
+	})
+})
@@ -0,0 +1,13 @@
+package eofsignal_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestEOFSignal(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "EOFSignal Suite")
+}
@@ -0,0 +1,200 @@
+package eofsignal
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHalfCloseUnsupported is returned by CloseRead and CloseWrite when the
+// wrapped conn cannot be half-closed.
+var ErrHalfCloseUnsupported = errors.New("eofsignal: half close not supported")
+
+var (
+	_ net.Conn = (*lifecycleConn)(nil)
+)
+
+// ConnTrace is a set of hooks run at the stages of a connection's life.
+// Any hook may be nil.
+type ConnTrace struct {
+	// Open is called when the conn is wrapped.
+	Open func()
+	// FirstByte is called once, when the first byte is read, with the time
+	// passed since Open.
+	FirstByte func(wait time.Duration)
+	// Idle is called when a read or write ends a gap of at least
+	// IdleThreshold in which no bytes were transferred.
+	Idle          func(d time.Duration)
+	IdleThreshold time.Duration
+	// HalfClose is called after a successful CloseRead or CloseWrite.
+	HalfClose func(write bool)
+	// Close is called once, when the conn is closed.
+	Close func(ConnStats)
+}
+
+// ConnStats describes a connection at a point in its life.
+type ConnStats struct {
+	Opened    time.Time
+	FirstByte time.Time // zero if nothing was read
+	Closed    time.Time // zero if still open
+
+	BytesRead    int64
+	BytesWritten int64
+
+	// IdleTime is the sum of the gaps reported to ConnTrace.Idle, MaxIdle
+	// the longest gap between two transfers.
+	IdleTime time.Duration
+	MaxIdle  time.Duration
+
+	// Cause is the first read or write error, or the Close error if none
+	// was seen. It is nil for a clean local close.
+	Cause error
+}
+
+type lifecycleConn struct {
+	net.Conn
+	trace  *ConnTrace
+	opened time.Time
+
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+
+	mu         sync.Mutex // guards following 6 fields
+	firstByte  time.Time
+	lastActive time.Time
+	idleTime   time.Duration
+	maxIdle    time.Duration
+	cause      error
+	closed     time.Time
+}
+
+// NewLifecycleConn wraps conn, reporting its lifecycle to trace.
+func NewLifecycleConn(conn net.Conn, trace *ConnTrace) *lifecycleConn {
+	if trace == nil {
+		trace = &ConnTrace{}
+	}
+	now := time.Now()
+	c := &lifecycleConn{
+		Conn:       conn,
+		trace:      trace,
+		opened:     now,
+		lastActive: now,
+	}
+	if trace.Open != nil {
+		trace.Open()
+	}
+	return c
+}
+
+func (c *lifecycleConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	c.bytesRead.Add(int64(n))
+	c.transferred(n, err, true)
+	return n, err
+}
+
+func (c *lifecycleConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	c.bytesWritten.Add(int64(n))
+	c.transferred(n, err, false)
+	return n, err
+}
+
+func (c *lifecycleConn) transferred(n int, err error, read bool) {
+	if n == 0 && err == nil {
+		return
+	}
+	now := time.Now()
+	var firstByte, idle time.Duration
+
+	c.mu.Lock()
+	if err != nil && c.cause == nil {
+		c.cause = err
+	}
+	if n > 0 {
+		if read && c.firstByte.IsZero() {
+			c.firstByte = now
+			firstByte = now.Sub(c.opened)
+		}
+		gap := now.Sub(c.lastActive)
+		c.lastActive = now
+		if gap > c.maxIdle {
+			c.maxIdle = gap
+		}
+		if c.trace.IdleThreshold > 0 && gap >= c.trace.IdleThreshold {
+			c.idleTime += gap
+			idle = gap
+		}
+	}
+	c.mu.Unlock()
+
+	if firstByte > 0 && c.trace.FirstByte != nil {
+		c.trace.FirstByte(firstByte)
+	}
+	if idle > 0 && c.trace.Idle != nil {
+		c.trace.Idle(idle)
+	}
+}
+
+// CloseRead shuts down the reading side of the wrapped conn, if supported.
+func (c *lifecycleConn) CloseRead() error {
+	cr, ok := c.Conn.(interface{ CloseRead() error })
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	return c.halfClose(cr.CloseRead(), false)
+}
+
+// CloseWrite shuts down the writing side of the wrapped conn, if supported.
+func (c *lifecycleConn) CloseWrite() error {
+	cw, ok := c.Conn.(interface{ CloseWrite() error })
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	return c.halfClose(cw.CloseWrite(), true)
+}
+
+func (c *lifecycleConn) halfClose(err error, write bool) error {
+	if err == nil && c.trace.HalfClose != nil {
+		c.trace.HalfClose(write)
+	}
+	return err
+}
+
+func (c *lifecycleConn) Close() error {
+	err := c.Conn.Close()
+
+	c.mu.Lock()
+	if !c.closed.IsZero() {
+		c.mu.Unlock()
+		return err
+	}
+	c.closed = time.Now()
+	if c.cause == nil {
+		c.cause = err
+	}
+	c.mu.Unlock()
+
+	if c.trace.Close != nil {
+		c.trace.Close(c.Stats())
+	}
+	return err
+}
+
+// Stats returns a snapshot of the connection's counters.
+func (c *lifecycleConn) Stats() ConnStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ConnStats{
+		Opened:       c.opened,
+		FirstByte:    c.firstByte,
+		Closed:       c.closed,
+		BytesRead:    c.bytesRead.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		IdleTime:     c.idleTime,
+		MaxIdle:      c.maxIdle,
+		Cause:        c.cause,
+	}
+}
@@ -0,0 +1,113 @@
+package eofsignal
+
+import (
+	"io"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("lifecycleConn", func() {
+	var (
+		client, server net.Conn
+		events         []string
+		stats          []ConnStats
+		trace          *ConnTrace
+	)
+
+	BeforeEach(func() {
+		client, server = net.Pipe()
+		events, stats = nil, nil
+		trace = &ConnTrace{
+			Open:          func() { events = append(events, "open") },
+			FirstByte:     func(time.Duration) { events = append(events, "first-byte") },
+			Idle:          func(time.Duration) { events = append(events, "idle") },
+			IdleThreshold: time.Millisecond * 20,
+			Close:         func(s ConnStats) { stats = append(stats, s) },
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reports open, first byte, byte counters and close", func() {
+		c := NewLifecycleConn(client, trace)
+		go server.Write([]byte("hello"))
+		b := make([]byte, 5)
+		_, err := io.ReadFull(c, b)
+		Expect(err).ToNot(HaveOccurred())
+
+		go io.ReadAll(server)
+		_, err = c.Write([]byte("hi"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.Close()).To(Succeed())
+		c.Close()
+		Expect(events).To(Equal([]string{"open", "first-byte"}))
+		Expect(stats).To(HaveLen(1))
+		Expect(stats[0].BytesRead).To(Equal(int64(5)))
+		Expect(stats[0].BytesWritten).To(Equal(int64(2)))
+		Expect(stats[0].FirstByte).ToNot(BeZero())
+		Expect(stats[0].Closed).ToNot(BeZero())
+		Expect(stats[0].Cause).ToNot(HaveOccurred())
+	})
+
+	It("reports idle gaps between transfers", func() {
+		c := NewLifecycleConn(client, trace)
+		go func() {
+			server.Write([]byte("a"))
+			time.Sleep(time.Millisecond * 30)
+			server.Write([]byte("b"))
+		}()
+		_, err := io.ReadFull(c, make([]byte, 2))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(Equal([]string{"open", "first-byte", "idle"}))
+
+		s := c.Stats()
+		Expect(s.IdleTime).To(BeNumerically(">=", trace.IdleThreshold))
+		Expect(s.MaxIdle).To(Equal(s.IdleTime))
+		Expect(s.Closed).To(BeZero())
+	})
+
+	It("records the first error as close cause", func() {
+		c := NewLifecycleConn(client, trace)
+		server.Close()
+		_, err := c.Read(make([]byte, 1))
+		Expect(err).To(Equal(io.EOF))
+		c.Close()
+		Expect(stats[0].Cause).To(Equal(io.EOF))
+	})
+
+	It("passes half close through to the wrapped conn", func() {
+		c := NewLifecycleConn(client, trace)
+		Expect(c.CloseWrite()).To(Equal(ErrHalfCloseUnsupported))
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			b, _ := io.ReadAll(conn)
+			conn.Write(b)
+		}()
+		tcp, err := net.Dial("tcp", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+
+		var halfClosed []bool
+		c = NewLifecycleConn(tcp, &ConnTrace{HalfClose: func(write bool) { halfClosed = append(halfClosed, write) }})
+		defer c.Close()
+		c.Write([]byte("echo"))
+		Expect(c.CloseWrite()).To(Succeed())
+		b, err := io.ReadAll(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("echo"))
+		Expect(halfClosed).To(Equal([]bool{true}))
+	})
+})
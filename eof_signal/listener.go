@@ -0,0 +1,131 @@
+package eofsignal
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+var (
+	_ net.Listener = (*eofSignalListener)(nil)
+)
+
+// eofSignalListener wraps every accepted conn in an eofSignalConn and
+// tracks it until it is closed, so a server can drain its connections on
+// shutdown.
+type eofSignalListener struct {
+	net.Listener
+	fn func(net.Conn, error)
+
+	mu      sync.Mutex // guards following 2 fields
+	active  map[*trackedConn]struct{}
+	drained chan struct{} // closed while no conn is active
+}
+
+// NewEOFSignalListener wraps ln. fn, if non-nil, is called with the accepted
+// conn whenever its eofSignalConn would signal.
+func NewEOFSignalListener(ln net.Listener, fn func(net.Conn, error)) *eofSignalListener {
+	drained := make(chan struct{})
+	close(drained)
+	return &eofSignalListener{
+		Listener: ln,
+		fn:       fn,
+		active:   make(map[*trackedConn]struct{}),
+		drained:  drained,
+	}
+}
+
+func (l *eofSignalListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{ln: l}
+	tc.eofSignalConn = NewEOFSignalConn(conn, func(err error) {
+		if l.fn != nil {
+			l.fn(tc, err)
+		}
+	})
+
+	l.mu.Lock()
+	if len(l.active) == 0 {
+		l.drained = make(chan struct{})
+	}
+	l.active[tc] = struct{}{}
+	l.mu.Unlock()
+	return tc, nil
+}
+
+// Active returns the number of accepted conns not closed yet.
+func (l *eofSignalListener) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.active)
+}
+
+// Wait blocks until no accepted conn is active or ctx is done.
+func (l *eofSignalListener) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		drained := l.drained
+		l.mu.Unlock()
+		select {
+		case <-drained:
+			// a conn may have been accepted right after draining
+			if l.Active() == 0 {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// CloseActive force-closes all active conns.
+func (l *eofSignalListener) CloseActive() {
+	l.mu.Lock()
+	conns := make([]*trackedConn, 0, len(l.active))
+	for tc := range l.active {
+		conns = append(conns, tc)
+	}
+	l.mu.Unlock()
+
+	for _, tc := range conns {
+		tc.Close()
+	}
+}
+
+// Shutdown closes the listener and waits for active conns to drain. Conns
+// still active when ctx is done are closed and ctx's error is returned.
+func (l *eofSignalListener) Shutdown(ctx context.Context) error {
+	err := l.Listener.Close()
+	if werr := l.Wait(ctx); werr != nil {
+		l.CloseActive()
+		return werr
+	}
+	return err
+}
+
+func (l *eofSignalListener) remove(tc *trackedConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.active[tc]; !ok {
+		return
+	}
+	delete(l.active, tc)
+	if len(l.active) == 0 {
+		close(l.drained)
+	}
+}
+
+// trackedConn exposes the eofSignalConn's Done, Err and State to servers.
+type trackedConn struct {
+	*eofSignalConn
+	ln *eofSignalListener
+}
+
+func (tc *trackedConn) Close() error {
+	err := tc.eofSignalConn.Close()
+	tc.ln.remove(tc)
+	return err
+}
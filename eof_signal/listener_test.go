@@ -0,0 +1,111 @@
+package eofsignal
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("eofSignalListener", func() {
+	var (
+		ln *eofSignalListener
+
+		mu     sync.Mutex
+		causes []error
+	)
+
+	BeforeEach(func() {
+		causes = nil
+		raw, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		ln = NewEOFSignalListener(raw, func(conn net.Conn, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			causes = append(causes, err)
+		})
+	})
+
+	AfterEach(func() {
+		ln.Close()
+		ln.CloseActive()
+	})
+
+	accept := func() (client, server net.Conn) {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		server, err = ln.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		return client, server
+	}
+
+	It("tracks accepted conns until they are closed", func() {
+		client, server := accept()
+		defer client.Close()
+		Expect(ln.Active()).To(Equal(1))
+
+		client.Close()
+		_, err := server.Read(make([]byte, 1))
+		Expect(err).To(Equal(io.EOF))
+		Expect(ln.Active()).To(Equal(1))
+
+		Expect(server.(*trackedConn).Done()).To(BeClosed())
+		server.Close()
+		Expect(ln.Active()).To(BeZero())
+		mu.Lock()
+		Expect(causes).To(ContainElement(io.EOF))
+		mu.Unlock()
+	})
+
+	It("accepted conns can be half closed", func() {
+		client, server := accept()
+		defer client.Close()
+		defer server.Close()
+
+		cw, ok := server.(interface{ CloseWrite() error })
+		Expect(ok).To(BeTrue())
+		server.Write([]byte("bye"))
+		Expect(cw.CloseWrite()).To(Succeed())
+		b, err := io.ReadAll(client)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("bye"))
+
+		// the read side stays open
+		client.Write([]byte("ack"))
+		b = make([]byte, 3)
+		_, err = io.ReadFull(server, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("ack"))
+		Expect(server.(*trackedConn).Done()).ToNot(BeClosed())
+	})
+
+	It("shutdown waits for active conns to drain", func() {
+		client, server := accept()
+		defer client.Close()
+		go func() {
+			time.Sleep(time.Millisecond * 10)
+			server.Close()
+		}()
+		Expect(ln.Shutdown(context.Background())).To(Succeed())
+		Expect(ln.Active()).To(BeZero())
+
+		_, err := ln.Accept()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("shutdown force-closes stragglers after the deadline", func() {
+		client, server := accept()
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		Expect(ln.Shutdown(ctx)).To(Equal(context.DeadlineExceeded))
+		Expect(ln.Active()).To(BeZero())
+
+		_, err := server.Read(make([]byte, 1))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,290 @@
+package eofsignal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Get once the pool has been closed.
+var ErrPoolClosed = errors.New("eofsignal: pool closed")
+
+// DialFunc opens a new connection to addr.
+type DialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// PoolOption configures a connPool.
+type PoolOption func(*connPool)
+
+// WithMaxConnsPerHost limits the number of open connections, idle or in
+// use, per address. Get blocks while the limit is reached.
+func WithMaxConnsPerHost(n int) PoolOption {
+	return func(p *connPool) {
+		p.maxConnsPerHost = n
+	}
+}
+
+// WithMaxIdlePerHost limits the number of idle connections kept per address.
+func WithMaxIdlePerHost(n int) PoolOption {
+	return func(p *connPool) {
+		p.maxIdlePerHost = n
+	}
+}
+
+// WithIdleTimeout closes connections that stay idle for longer than d.
+func WithIdleTimeout(d time.Duration) PoolOption {
+	return func(p *connPool) {
+		p.idleTimeout = d
+	}
+}
+
+// WithHealthCheck runs fn on an idle connection before handing it out
+// again. Connections failing the check are closed.
+func WithHealthCheck(fn func(net.Conn) error) PoolOption {
+	return func(p *connPool) {
+		p.healthCheck = fn
+	}
+}
+
+const defaultMaxIdlePerHost = 2
+
+// connPool keeps connections for reuse once the response read from them
+// was fully consumed. Any read error or early close evicts the connection.
+type connPool struct {
+	dial            DialFunc
+	maxConnsPerHost int
+	maxIdlePerHost  int
+	idleTimeout     time.Duration
+	healthCheck     func(net.Conn) error
+
+	mu     sync.Mutex // guards following 2 fields and all pooledConn state
+	closed bool
+	hosts  map[string]*hostConns
+}
+
+type hostConns struct {
+	idle  []*pooledConn // most recently used last
+	total int           // idle and in use
+	wait  chan struct{} // closed when a connection becomes available
+}
+
+func (h *hostConns) notify() {
+	if h.wait != nil {
+		close(h.wait)
+		h.wait = nil
+	}
+}
+
+func (h *hostConns) removeIdle(pc *pooledConn) {
+	for i, c := range h.idle {
+		if c == pc {
+			h.idle = append(h.idle[:i], h.idle[i+1:]...)
+			return
+		}
+	}
+}
+
+func NewConnPool(dial DialFunc, opts ...PoolOption) *connPool {
+	p := &connPool{
+		dial:           dial,
+		maxIdlePerHost: defaultMaxIdlePerHost,
+		hosts:          make(map[string]*hostConns),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Get returns an idle connection to addr, or dials a new one.
+func (p *connPool) Get(ctx context.Context, addr string) (*pooledConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		h := p.hosts[addr]
+		if h == nil {
+			h = &hostConns{}
+			p.hosts[addr] = h
+		}
+
+		if n := len(h.idle); n > 0 {
+			pc := h.idle[n-1]
+			h.idle = h.idle[:n-1]
+			pc.idle = false
+			if pc.idleTimer != nil {
+				pc.idleTimer.Stop()
+			}
+			p.mu.Unlock()
+			if p.healthCheck != nil {
+				if err := p.healthCheck(pc.raw); err != nil {
+					pc.Close()
+					continue
+				}
+			}
+			return pc, nil
+		}
+
+		if p.maxConnsPerHost <= 0 || h.total < p.maxConnsPerHost {
+			h.total++
+			p.mu.Unlock()
+			return p.dialConn(ctx, addr)
+		}
+
+		if h.wait == nil {
+			h.wait = make(chan struct{})
+		}
+		wait := h.wait
+		p.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *connPool) dialConn(ctx context.Context, addr string) (*pooledConn, error) {
+	raw, err := p.dial(ctx, addr)
+	if err != nil {
+		p.mu.Lock()
+		p.release(addr)
+		p.mu.Unlock()
+		return nil, err
+	}
+	pc := &pooledConn{
+		pool: p,
+		addr: addr,
+		raw:  raw,
+	}
+	pc.Conn = NewEOFSignalConn(raw, func(error) {
+		pc.Close()
+	})
+	return pc, nil
+}
+
+// release frees one connection slot of addr, caller must hold p.mu.
+func (p *connPool) release(addr string) {
+	h := p.hosts[addr]
+	h.total--
+	h.notify()
+	if h.total == 0 {
+		delete(p.hosts, addr)
+	}
+}
+
+// Close closes all idle connections and fails blocked Gets with
+// ErrPoolClosed. Connections in use are closed when they would otherwise be
+// returned to the pool.
+func (p *connPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	var idle []*pooledConn
+	for _, h := range p.hosts {
+		idle = append(idle, h.idle...)
+		h.notify()
+	}
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		pc.Close()
+	}
+	return nil
+}
+
+// pooledConn is a connection handed out by connPool. Reads go through an
+// eofSignalConn, so any read error evicts it from the pool.
+type pooledConn struct {
+	net.Conn
+
+	pool *connPool
+	addr string
+	raw  net.Conn
+
+	// guarded by pool.mu
+	idle      bool
+	dead      bool
+	idleTimer *time.Timer
+}
+
+// WrapBody wraps the body of a response read from pc. The connection goes
+// back to the pool once body is read until io.EOF, and is closed if body
+// fails or is closed early.
+func (pc *pooledConn) WrapBody(body io.ReadCloser) io.ReadCloser {
+	return NewBodyEOFSignal(body, func(err error) error {
+		if err == io.EOF {
+			pc.Release()
+		} else {
+			pc.Close()
+		}
+		return err
+	}, WithEarlyCloseFn(func() error {
+		return pc.Close()
+	}))
+}
+
+// Release returns pc to the idle pool. It must only be called when no
+// unread response data is left on the connection.
+func (pc *pooledConn) Release() {
+	p := pc.pool
+	p.mu.Lock()
+	if pc.dead || pc.idle {
+		p.mu.Unlock()
+		return
+	}
+	h := p.hosts[pc.addr]
+	if p.closed || len(h.idle) >= p.maxIdlePerHost {
+		p.mu.Unlock()
+		pc.Close()
+		return
+	}
+	pc.idle = true
+	h.idle = append(h.idle, pc)
+	if p.idleTimeout > 0 {
+		pc.idleTimer = time.AfterFunc(p.idleTimeout, pc.expire)
+	}
+	h.notify()
+	p.mu.Unlock()
+}
+
+func (pc *pooledConn) expire() {
+	pc.pool.mu.Lock()
+	evicted := pc.idle && pc.evictLocked()
+	pc.pool.mu.Unlock()
+	if evicted {
+		pc.raw.Close()
+	}
+}
+
+// Close closes the connection and removes it from the pool.
+func (pc *pooledConn) Close() error {
+	pc.pool.mu.Lock()
+	evicted := pc.evictLocked()
+	pc.pool.mu.Unlock()
+	if !evicted {
+		return nil
+	}
+	return pc.raw.Close()
+}
+
+// evictLocked removes pc from the pool and reports whether the caller
+// should close it, caller must hold pool.mu.
+func (pc *pooledConn) evictLocked() bool {
+	if pc.dead {
+		return false
+	}
+	pc.dead = true
+	if pc.idle {
+		pc.idle = false
+		pc.pool.hosts[pc.addr].removeIdle(pc)
+		if pc.idleTimer != nil {
+			pc.idleTimer.Stop()
+		}
+	}
+	pc.pool.release(pc.addr)
+	return true
+}
@@ -0,0 +1,160 @@
+package eofsignal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("connPool", func() {
+	var (
+		dials   int
+		servers []net.Conn
+		dial    = func(ctx context.Context, addr string) (net.Conn, error) {
+			dials++
+			c, s := net.Pipe()
+			servers = append(servers, s)
+			return c, nil
+		}
+	)
+
+	BeforeEach(func() {
+		dials, servers = 0, nil
+	})
+
+	AfterEach(func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	})
+
+	respond := func(s net.Conn, msg string) {
+		go s.Write([]byte(msg))
+	}
+
+	It("reuses a connection once its body was fully read", func() {
+		p := NewConnPool(dial)
+		pc, err := p.Get(context.Background(), "a")
+		Expect(err).ToNot(HaveOccurred())
+
+		respond(servers[0], "hello")
+		body := pc.WrapBody(io.NopCloser(io.LimitReader(pc, 5)))
+		b, err := io.ReadAll(body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("hello"))
+		Expect(body.Close()).To(Succeed())
+		Expect(p.hosts["a"].idle).To(HaveLen(1))
+
+		pc2, err := p.Get(context.Background(), "a")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pc2).To(BeIdenticalTo(pc))
+		Expect(dials).To(Equal(1))
+	})
+
+	It("evicts a connection whose body was abandoned", func() {
+		p := NewConnPool(dial)
+		pc, _ := p.Get(context.Background(), "a")
+
+		respond(servers[0], "hello")
+		body := pc.WrapBody(io.NopCloser(io.LimitReader(pc, 5)))
+		body.Read(make([]byte, 2))
+		Expect(body.Close()).To(Succeed())
+		Expect(p.hosts).ToNot(HaveKey("a"))
+
+		_, err := pc.raw.Read(make([]byte, 1))
+		Expect(err).To(Equal(io.ErrClosedPipe))
+
+		p.Get(context.Background(), "a")
+		Expect(dials).To(Equal(2))
+	})
+
+	It("evicts a connection on read error", func() {
+		p := NewConnPool(dial)
+		pc, _ := p.Get(context.Background(), "a")
+		servers[0].Close()
+		_, err := pc.Read(make([]byte, 1))
+		Expect(err).To(Equal(io.EOF))
+		Expect(p.hosts).ToNot(HaveKey("a"))
+
+		pc.Release()
+		Expect(p.hosts).ToNot(HaveKey("a"))
+	})
+
+	It("blocks at the per host limit until a connection is released", func() {
+		p := NewConnPool(dial, WithMaxConnsPerHost(1))
+		pc, _ := p.Get(context.Background(), "a")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		_, err := p.Get(ctx, "a")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
+		_, err = p.Get(context.Background(), "b")
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			time.Sleep(time.Millisecond * 10)
+			pc.Release()
+		}()
+		pc2, err := p.Get(context.Background(), "a")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pc2).To(BeIdenticalTo(pc))
+	})
+
+	It("close fails Gets blocked at the per host limit", func() {
+		p := NewConnPool(dial, WithMaxConnsPerHost(1))
+		_, err := p.Get(context.Background(), "a")
+		Expect(err).ToNot(HaveOccurred())
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := p.Get(context.Background(), "a")
+			errc <- err
+		}()
+		Consistently(errc, time.Millisecond*20).ShouldNot(Receive())
+		Expect(p.Close()).To(Succeed())
+		Eventually(errc).Should(Receive(Equal(ErrPoolClosed)))
+	})
+
+	It("closes connections idle for too long", func() {
+		p := NewConnPool(dial, WithIdleTimeout(time.Millisecond*10))
+		pc, _ := p.Get(context.Background(), "a")
+		pc.Release()
+		Eventually(func() bool {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			return pc.dead
+		}).Should(BeTrue())
+		Expect(p.hosts).ToNot(HaveKey("a"))
+	})
+
+	It("drops idle connections failing the health check", func() {
+		p := NewConnPool(dial, WithHealthCheck(func(net.Conn) error {
+			return errors.New("unhealthy")
+		}))
+		pc, _ := p.Get(context.Background(), "a")
+		pc.Release()
+		pc2, err := p.Get(context.Background(), "a")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pc2).ToNot(BeIdenticalTo(pc))
+		Expect(dials).To(Equal(2))
+	})
+
+	It("closed pool refuses new connections and closes released ones", func() {
+		p := NewConnPool(dial)
+		pc, _ := p.Get(context.Background(), "a")
+		idle, _ := p.Get(context.Background(), "a")
+		idle.Release()
+
+		Expect(p.Close()).To(Succeed())
+		_, err := p.Get(context.Background(), "a")
+		Expect(err).To(Equal(ErrPoolClosed))
+		pc.Release()
+		Expect(p.hosts).To(BeEmpty())
+	})
+})
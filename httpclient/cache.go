@@ -31,9 +31,10 @@ func (c *memcacheImpl) getCacheItem(req *http.Request) (item *cacheItem, ok bool
 	if item, ok := c.items[key]; ok {
 		return item, true
 	}
-	item = newCacheItem(key, func() {
-		c.DeleteItem(key)
-	})
+	item = newCacheItem(key, nil)
+	item.onClose = func() {
+		c.deleteItem(key, item)
+	}
 	c.items[key] = item
 	return item, false
 }
@@ -53,6 +54,17 @@ func (c *memcacheImpl) TryRegister(req *http.Request) (item *cacheItem, waiter *
 	return ci, ci.NewWaiter(), ok
 }
 
+// deleteItem deletes key only if it still maps to item, so a stale item
+// can not evict its successor.
+func (c *memcacheImpl) deleteItem(key CacheKey, item *cacheItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items[key] == item {
+		delete(c.items, key)
+	}
+}
+
 func (c *memcacheImpl) DeleteItem(key CacheKey) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -32,9 +32,18 @@ func (w *cacheItemWaiter) WaitForResolved(ctx context.Context) (*http.Response,
 
 func (w *cacheItemWaiter) Close() {
 	w.once.Do(func() {
-		if w.ci.waiters.Add(-1) == 0 && w.ci.onClose != nil {
+		if w.ci.waiters.Add(-1) != 0 {
+			return
+		}
+		w.ci.abandoned.Store(true)
+		if w.ci.onClose != nil {
 			w.ci.onClose()
 		}
+		select {
+		case <-w.ci.resolved:
+			w.ci.releaseBody()
+		default:
+		}
 	})
 }
 
@@ -49,6 +58,11 @@ type cacheItem struct {
 
 	expireAt time.Time
 	waiters  atomic.Int32
+
+	// abandoned is set once the last waiter left; the wrapped body is
+	// closed then, as every caller only ever got a fork of it
+	abandoned   atomic.Bool
+	releaseOnce sync.Once
 }
 
 func newCacheItem(key CacheKey, onClose func()) *cacheItem {
@@ -62,17 +76,42 @@ func newCacheItem(key CacheKey, onClose func()) *cacheItem {
 }
 
 func (ci *cacheItem) Resolve(resp *http.Response, err error) (ok bool) {
+	return ci.resolve(resp, err, nil)
+}
+
+func (ci *cacheItem) resolve(resp *http.Response, err error, resumer *rangeResumer) (ok bool) {
 	if resp == nil && err == nil {
 		panic("resp and err can not both be nil")
 	}
 	ok = ci.status.CompareAndSwap(cacheStatusWaitForResponse, cacheStatusGotResponse)
 	if ok {
-		ci.resp, ci.err = wrapResponse(resp), err
+		ci.resp, ci.err = wrapResponse(resp, ci.onBodyError, resumer), err
 		close(ci.resolved)
+		if ci.abandoned.Load() {
+			ci.releaseBody()
+		}
 	}
 	return ok
 }
 
+// releaseBody closes the item's own fork of the body, so the origin body is
+// closed once every fork handed out to callers is closed too.
+func (ci *cacheItem) releaseBody() {
+	ci.releaseOnce.Do(func() {
+		if ci.resp != nil && ci.resp.Body != nil {
+			ci.resp.Body.Close()
+		}
+	})
+}
+
+// onBodyError evicts the item, so a truncated or failed body is never
+// handed to later requests; waiters already holding it see the error.
+func (ci *cacheItem) onBodyError(err error) {
+	if ci.onClose != nil {
+		ci.onClose()
+	}
+}
+
 func (ci *cacheItem) NewWaiter() *cacheItemWaiter {
 	ci.waiters.Add(1)
 	return &cacheItemWaiter{ci: ci}
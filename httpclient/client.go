@@ -31,6 +31,7 @@ import "net/http"
 type CachedHTTPClient struct {
 	cache      *memcacheImpl
 	httpclient HTTPRequestDoer
+	maxResumes int
 }
 
 func NewCachedHTTPClient(cache *memcacheImpl, httpclient HTTPRequestDoer) *CachedHTTPClient {
@@ -40,6 +41,12 @@ func NewCachedHTTPClient(cache *memcacheImpl, httpclient HTTPRequestDoer) *Cache
 	}
 }
 
+// EnableResume lets response bodies that fail midway be continued with up
+// to maxAttempts Range requests, if the upstream supports them.
+func (cl *CachedHTTPClient) EnableResume(maxAttempts int) {
+	cl.maxResumes = maxAttempts
+}
+
 func (cl *CachedHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	ci, waiter, ok := cl.cache.TryRegister(req)
 	defer waiter.Close()
@@ -50,8 +57,14 @@ func (cl *CachedHTTPClient) Do(req *http.Request) (*http.Response, error) {
 }
 
 func (cl *CachedHTTPClient) doRequest(req *http.Request, ci *cacheItem) {
-	resp, err := cl.httpclient.Do(req)
-	ci.Resolve(resp, err)
+	sent, release := EnableBodyReplay(req)
+	resp, err := cl.httpclient.Do(sent)
+	release()
+	var resumer *rangeResumer
+	if err == nil {
+		resumer = newRangeResumer(cl.httpclient, resp, cl.maxResumes)
+	}
+	ci.resolve(resp, err, resumer)
 }
 
 func (cl *CachedHTTPClient) ReceivePush(resp *http.Response) (ok bool) {
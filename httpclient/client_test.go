@@ -1,10 +1,13 @@
 package httpclient
 
 import (
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -57,6 +60,63 @@ var _ = Describe("CachedHTTPClient", func() {
 		}
 	})
 
+	It("request body can be replayed by the doer", func() {
+		post, _ := http.NewRequest("POST", "http://example.com", nil)
+		post.Body = io.NopCloser(strings.NewReader("payload"))
+		httpclient.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			Expect(req).ToNot(BeIdenticalTo(post))
+			io.ReadFull(req.Body, make([]byte, 3))
+			req.Body.Close()
+			body, err := req.GetBody()
+			Expect(err).ToNot(HaveOccurred())
+			b, _ := io.ReadAll(body)
+			Expect(string(b)).To(Equal("payload"))
+			return &http.Response{StatusCode: 200, Request: req}, nil
+		})
+		resp, err := client.Do(post)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(post.GetBody).To(BeNil())
+	})
+
+	Context("origin body", func() {
+		var closed chan struct{}
+		upstream := func() *http.Response {
+			closed = make(chan struct{})
+			resp := newTestResp(strings.NewReader("hello"), 10, nil)
+			resp.Body = closeNotifier{ReadCloser: resp.Body, closed: closed}
+			resp.Request = req
+			return resp
+		}
+
+		It("is closed once the caller closes its response body", func() {
+			httpclient.EXPECT().Do(gomock.Any()).Return(upstream(), nil)
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(closed).ToNot(BeClosed())
+			resp.Body.Close()
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("is closed if every caller left before it arrived", func() {
+			ci, waiter, _ := cache.TryRegister(req)
+			waiter.Close()
+			ci.Resolve(upstream(), nil)
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("is kept for a pushed response until its request came", func() {
+			client.ReceivePush(upstream())
+			Consistently(closed, time.Millisecond*50).ShouldNot(BeClosed())
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			b, _ := io.ReadAll(resp.Body)
+			Expect(string(b)).To(Equal("hello"))
+			resp.Body.Close()
+			Eventually(closed).Should(BeClosed())
+		})
+	})
+
 	Context("push", func() {
 		It("push response would resolve later incoming requests", func() {
 			setupMockClient(time.Millisecond*50, 0)
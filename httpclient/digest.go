@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"strings"
+
+	buffer "github.com/zckevin/go-libs/repeatable_buffer"
+)
+
+// digestAlgorithms maps lowercase algorithm names used by the Repr-Digest
+// and Digest headers to hash constructors, in order of preference.
+var digestAlgorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+	{"md5", md5.New},
+}
+
+// digestOption returns an option verifying the body against the digest
+// advertised by resp, if it carries one in a supported algorithm. Bodies
+// transparently decompressed by net/http are skipped, since the digest
+// covers the encoded representation. So are the representation digests of
+// 206 responses, which hash the whole resource rather than the range sent.
+func digestOption(resp *http.Response) (buffer.StreamWrapperOption, bool) {
+	if resp.Uncompressed {
+		return nil, false
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		return contentMD5Option(resp)
+	}
+	if v := resp.Header.Get("Repr-Digest"); v != "" {
+		// sha-256=:BASE64:, sha-512=:BASE64:
+		if opt, ok := parseDigestList(v, true); ok {
+			return opt, true
+		}
+	}
+	if v := resp.Header.Get("Digest"); v != "" {
+		// SHA-256=BASE64,MD5=BASE64
+		if opt, ok := parseDigestList(v, false); ok {
+			return opt, true
+		}
+	}
+	return contentMD5Option(resp)
+}
+
+// contentMD5Option verifies the body against Content-MD5, which covers the
+// bytes of the message body, including the range of a 206 response.
+func contentMD5Option(resp *http.Response) (buffer.StreamWrapperOption, bool) {
+	if v := resp.Header.Get("Content-MD5"); v != "" {
+		if sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v)); err == nil {
+			return buffer.WithDigest(md5.New(), sum), true
+		}
+	}
+	return nil, false
+}
+
+func parseDigestList(v string, colons bool) (buffer.StreamWrapperOption, bool) {
+	sums := make(map[string][]byte)
+	for _, item := range strings.Split(v, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		if colons {
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				continue
+			}
+			value = value[1 : len(value)-1]
+		}
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		sums[strings.ToLower(name)] = sum
+	}
+	for _, alg := range digestAlgorithms {
+		if sum, ok := sums[alg.name]; ok {
+			return buffer.WithDigest(alg.new(), sum), true
+		}
+	}
+	return nil, false
+}
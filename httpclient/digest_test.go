@@ -0,0 +1,66 @@
+package httpclient
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	buffer "github.com/zckevin/go-libs/repeatable_buffer"
+)
+
+var _ = Describe("digest", func() {
+	body := "hello world"
+	sha := sha256.Sum256([]byte(body))
+	md := md5.Sum([]byte(body))
+	shaB64 := base64.StdEncoding.EncodeToString(sha[:])
+	mdB64 := base64.StdEncoding.EncodeToString(md[:])
+	rangeMd := md5.Sum([]byte(body[:5]))
+	rangeMdB64 := base64.StdEncoding.EncodeToString(rangeMd[:])
+
+	readBody := func(resp *http.Response) error {
+		_, err := io.ReadAll(wrapResponse(resp, nil, nil).Body)
+		return err
+	}
+
+	DescribeTable("verifies body against advertised digest",
+		func(status int, header http.Header, body string, wantMismatch bool) {
+			resp := newTestResp(strings.NewReader(body), int64(len(body)), header)
+			resp.StatusCode = status
+			err := readBody(resp)
+			if wantMismatch {
+				Expect(errors.Is(err, buffer.ErrDigestMismatch)).To(BeTrue())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		},
+		Entry("Repr-Digest", 200, http.Header{"Repr-Digest": {"sha-256=:" + shaB64 + ":"}}, body, false),
+		Entry("Repr-Digest mismatch", 200, http.Header{"Repr-Digest": {"sha-256=:" + shaB64 + ":"}}, "hello w0rld", true),
+		Entry("Digest", 200, http.Header{"Digest": {"unknown=abc, SHA-256=" + shaB64}}, body, false),
+		Entry("Digest mismatch", 200, http.Header{"Digest": {"unknown=abc, SHA-256=" + shaB64}}, "hello w0rld", true),
+		Entry("Content-MD5", 200, http.Header{"Content-Md5": {mdB64}}, body, false),
+		Entry("Content-MD5 mismatch", 200, http.Header{"Content-Md5": {mdB64}}, "hello w0rld", true),
+		Entry("206 with Repr-Digest of the whole resource", 206, http.Header{
+			"Content-Range": {"bytes 0-4/11"},
+			"Repr-Digest":   {"sha-256=:" + shaB64 + ":"},
+			"Digest":        {"SHA-256=" + shaB64},
+		}, body[:5], false),
+		Entry("206 with Content-MD5 of the range", 206, http.Header{
+			"Content-Range": {"bytes 0-4/11"},
+			"Content-Md5":   {rangeMdB64},
+		}, "hellx", true),
+	)
+
+	It("ignores unsupported or decompressed digests", func() {
+		Expect(readBody(newTestResp(strings.NewReader("x"), 1, http.Header{"Repr-Digest": {"crc32=:AAAA:"}}))).To(Succeed())
+
+		resp := newTestResp(strings.NewReader("x"), 1, http.Header{"Content-Md5": {mdB64}})
+		resp.Uncompressed = true
+		Expect(readBody(resp)).To(Succeed())
+	})
+})
@@ -0,0 +1,161 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrDoerPanic wraps a panic recovered by the Recover middleware.
+var ErrDoerPanic = errors.New("httpclient: doer panicked")
+
+// HTTPRequestDoerFunc adapts a function to an HTTPRequestDoer.
+type HTTPRequestDoerFunc func(req *http.Request) (*http.Response, error)
+
+func (f HTTPRequestDoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps an HTTPRequestDoer with extra behaviour. A
+// CachedHTTPClient is an HTTPRequestDoer too, so middlewares can be put
+// both in front of and below it.
+type Middleware func(HTTPRequestDoer) HTTPRequestDoer
+
+// Chain wraps doer in mws. The first middleware is the outermost one, so
+// it sees the request first and the response last.
+func Chain(doer HTTPRequestDoer, mws ...Middleware) HTTPRequestDoer {
+	for i := len(mws) - 1; i >= 0; i-- {
+		doer = mws[i](doer)
+	}
+	return doer
+}
+
+// Retry returns a middleware retrying requests through a retryDoer.
+func Retry(opts ...RetryOption) Middleware {
+	return func(next HTTPRequestDoer) HTTPRequestDoer {
+		return NewRetryDoer(next, opts...)
+	}
+}
+
+// Headers sets the headers of h that the request does not carry yet.
+func Headers(h http.Header) Middleware {
+	return func(next HTTPRequestDoer) HTTPRequestDoer {
+		return HTTPRequestDoerFunc(func(req *http.Request) (*http.Response, error) {
+			var clone *http.Request
+			for k, v := range h {
+				if _, ok := req.Header[http.CanonicalHeaderKey(k)]; ok {
+					continue
+				}
+				if clone == nil {
+					clone = cloneRequest(req)
+				}
+				clone.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+			}
+			if clone != nil {
+				req = clone
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// UserAgent sets the User-Agent header unless the request has one.
+func UserAgent(ua string) Middleware {
+	return Headers(http.Header{"User-Agent": {ua}})
+}
+
+// DefaultRequestIDHeader is the header used by RequestID if none is given.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// RequestID propagates a request id in header, DefaultRequestIDHeader if
+// empty. An id already in the header is kept, otherwise the one of the
+// request context is used, or a random one is generated.
+func RequestID(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(next HTTPRequestDoer) HTTPRequestDoer {
+		return HTTPRequestDoerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				id, ok := RequestIDFromContext(req.Context())
+				if !ok {
+					id = newRequestID()
+				}
+				req = cloneRequest(req)
+				req.Header.Set(header, id)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Timing reports how long next took to return the response headers.
+func Timing(fn func(req *http.Request, resp *http.Response, err error, d time.Duration)) Middleware {
+	return func(next HTTPRequestDoer) HTTPRequestDoer {
+		return HTTPRequestDoerFunc(func(req *http.Request) (*http.Response, error) {
+			started := time.Now()
+			resp, err := next.Do(req)
+			fn(req, resp, err, time.Since(started))
+			return resp, err
+		})
+	}
+}
+
+// Logging logs every request with its outcome and duration through logf,
+// e.g. log.Printf. Passwords in the URL are redacted.
+func Logging(logf func(format string, args ...any)) Middleware {
+	return Timing(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		if err != nil {
+			logf("%s %s: %v (%s)", req.Method, req.URL.Redacted(), err, d)
+			return
+		}
+		logf("%s %s: %d (%s)", req.Method, req.URL.Redacted(), resp.StatusCode, d)
+	})
+}
+
+// Recover turns a panic in next into an error wrapping ErrDoerPanic.
+func Recover() Middleware {
+	return func(next HTTPRequestDoer) HTTPRequestDoer {
+		return HTTPRequestDoerFunc(func(req *http.Request) (resp *http.Response, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					resp, err = nil, fmt.Errorf("%w: %v", ErrDoerPanic, r)
+				}
+			}()
+			return next.Do(req)
+		})
+	}
+}
+
+// cloneRequest copies req so that its headers can be changed without
+// affecting the caller. The body is shared.
+func cloneRequest(req *http.Request) *http.Request {
+	clone := req.Clone(req.Context())
+	if clone.Header == nil {
+		clone.Header = make(http.Header)
+	}
+	return clone
+}
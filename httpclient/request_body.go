@@ -0,0 +1,35 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+
+	buffer "github.com/zckevin/go-libs/repeatable_buffer"
+)
+
+// EnableBodyReplay returns a shallow copy of req that can be sent more
+// than once; req itself is left untouched. The copy's Body is a fork of a
+// RepeatableStreamWrapper over the original body, and its GetBody hands out
+// fresh forks reading it from the start, so retries and racing layers can
+// resend it without buffering it themselves.
+//
+// The returned release func must be called once no more replays are
+// needed; the original body is closed after every fork was closed too.
+// Requests without body, or whose GetBody is already set, are returned as
+// is.
+func EnableBodyReplay(req *http.Request) (replayable *http.Request, release func()) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return req, func() {}
+	}
+	// sw itself is never read, it only keeps the buffered body alive
+	// between the forks handed out to the transport
+	sw := buffer.NewRepeatableStreamWrapper(req.Body, nil, buffer.WithSizeHint(req.ContentLength))
+	r2 := *req
+	r2.Body = sw.Fork()
+	r2.GetBody = func() (io.ReadCloser, error) {
+		return sw.Fork(), nil
+	}
+	return &r2, func() {
+		sw.Close()
+	}
+}
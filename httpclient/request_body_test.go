@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EnableBodyReplay", func() {
+	newReq := func(body string) (*http.Request, chan struct{}) {
+		closed := make(chan struct{})
+		req, _ := http.NewRequest("POST", "http://example.com", nil)
+		req.Body = closeNotifier{ReadCloser: io.NopCloser(strings.NewReader(body)), closed: closed}
+		req.ContentLength = int64(len(body))
+		return req, closed
+	}
+
+	It("request body can be read again through GetBody", func() {
+		orig, closed := newReq("payload")
+		body := orig.Body
+		req, release := EnableBodyReplay(orig)
+		Expect(req).ToNot(BeIdenticalTo(orig))
+		Expect(orig.Body).To(BeIdenticalTo(body))
+		Expect(orig.GetBody).To(BeNil())
+
+		b := make([]byte, 3)
+		io.ReadFull(req.Body, b)
+		req.Body.Close()
+
+		for i := 0; i < 2; i++ {
+			body, err := req.GetBody()
+			Expect(err).ToNot(HaveOccurred())
+			b, err := io.ReadAll(body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("payload"))
+			body.Close()
+		}
+		Expect(closed).To(BeClosed())
+		release()
+	})
+
+	It("original body is closed once released and all forks are closed", func() {
+		req, closed := newReq("payload")
+		req, release := EnableBodyReplay(req)
+		body, _ := req.GetBody()
+
+		req.Body.Close()
+		release()
+		Expect(closed).ToNot(BeClosed())
+		body.Close()
+		Expect(closed).To(BeClosed())
+	})
+
+	It("requests without body or with GetBody are left untouched", func() {
+		req, _ := http.NewRequest("POST", "http://example.com", strings.NewReader("payload"))
+		replayable, release := EnableBodyReplay(req)
+		release()
+		Expect(replayable).To(BeIdenticalTo(req))
+
+		req, _ = http.NewRequest("GET", "http://example.com", nil)
+		replayable, release = EnableBodyReplay(req)
+		release()
+		Expect(replayable).To(BeIdenticalTo(req))
+		Expect(req.GetBody).To(BeNil())
+	})
+})
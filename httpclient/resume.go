@@ -0,0 +1,110 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errResumeRejected = errors.New("httpclient: upstream rejected range request")
+
+// rangeResumer reopens a response body that failed midway with a
+// "Range: bytes=N-" request, guarded by If-Range so a changed resource is
+// never spliced onto the bytes already read.
+type rangeResumer struct {
+	doer        HTTPRequestDoer
+	req         *http.Request
+	ifRange     string
+	size        int64 // complete length of the resource
+	maxAttempts int
+	attempts    int
+
+	// body is the upstream body currently read from, only accessed by the
+	// goroutine pulling from the stream wrapper.
+	body io.ReadCloser
+}
+
+// newRangeResumer returns nil if resp can not be resumed safely: only
+// complete GET responses of known length with a strong validator qualify.
+func newRangeResumer(doer HTTPRequestDoer, resp *http.Response, maxAttempts int) *rangeResumer {
+	if doer == nil || maxAttempts <= 0 || resp.Body == nil || resp.Body == http.NoBody || resp.ContentLength < 0 {
+		return nil
+	}
+	req := resp.Request
+	if req == nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || resp.Uncompressed {
+		return nil
+	}
+	if resp.Header.Get("Accept-Ranges") == "none" {
+		return nil
+	}
+	ifRange, ok := strongValidator(resp.Header)
+	if !ok {
+		return nil
+	}
+	return &rangeResumer{
+		doer:        doer,
+		req:         req,
+		ifRange:     ifRange,
+		size:        resp.ContentLength,
+		maxAttempts: maxAttempts,
+		body:        resp.Body,
+	}
+}
+
+// strongValidator returns the value to send in If-Range. Per RFC 9110
+// section 13.1.5 a date must not be sent when an entity tag was received,
+// and is only a strong validator if it is at least a second older than
+// the Date of the response.
+func strongValidator(h http.Header) (string, bool) {
+	if etag := h.Get("ETag"); etag != "" {
+		return etag, !strings.HasPrefix(etag, "W/")
+	}
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return "", false
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil || date.Sub(lastModified) < time.Second {
+		return "", false
+	}
+	return h.Get("Last-Modified"), true
+}
+
+// resume implements buffer.ResumeFunc.
+func (r *rangeResumer) resume(off int64, cause error) (io.Reader, error) {
+	if r.attempts >= r.maxAttempts {
+		return nil, cause
+	}
+	r.attempts++
+	r.body.Close()
+
+	req := r.req.Clone(r.req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	req.Header.Set("If-Range", r.ifRange)
+	resp, err := r.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent || !contentRangeStartsAt(resp, off, r.size) {
+		resp.Body.Close()
+		return nil, errResumeRejected
+	}
+	r.body = resp.Body
+	return resp.Body, nil
+}
+
+// contentRangeStartsAt reports whether resp holds the resource of
+// complete length size from off, e.g. "Content-Range: bytes 100-199/200"
+// for off 100 and size 200.
+func contentRangeStartsAt(resp *http.Response, off, size int64) bool {
+	cr := resp.Header.Get("Content-Range")
+	if !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-", off)) {
+		return false
+	}
+	_, complete, ok := strings.Cut(cr, "/")
+	return ok && complete == strconv.FormatInt(size, 10)
+}
@@ -0,0 +1,96 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing/iotest"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rangeResumer", func() {
+	const data = "hello world"
+	errReset := errors.New("connection reset")
+
+	var (
+		doer *MockHTTPRequestDoer
+		req  *http.Request
+	)
+
+	// brokenResp fails with errReset after the first 5 bytes of data
+	brokenResp := func(header http.Header) *http.Response {
+		resp := newTestResp(io.MultiReader(strings.NewReader(data[:5]), iotest.ErrReader(errReset)), int64(len(data)), header)
+		resp.Request = req
+		return resp
+	}
+
+	BeforeEach(func() {
+		doer = NewMockHTTPRequestDoer(mockCtrl)
+		req, _ = http.NewRequest("GET", "http://example.com", nil)
+	})
+
+	It("continues a broken body with a validated range request", func() {
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+			Expect(r.Header.Get("Range")).To(Equal("bytes=5-"))
+			Expect(r.Header.Get("If-Range")).To(Equal(`"v1"`))
+			return &http.Response{
+				StatusCode: http.StatusPartialContent,
+				Header:     http.Header{"Content-Range": {"bytes 5-10/11"}},
+				Body:       io.NopCloser(strings.NewReader(data[5:])),
+			}, nil
+		})
+
+		resp := brokenResp(http.Header{"Etag": {`"v1"`}})
+		resumer := newRangeResumer(doer, resp, 1)
+		Expect(resumer).ToNot(BeNil())
+		b, err := io.ReadAll(wrapResponse(resp, nil, resumer).Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal(data))
+	})
+
+	It("gives up if upstream answers with the full resource", func() {
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(data)),
+		}, nil)
+
+		resp := brokenResp(http.Header{"Etag": {`"v1"`}})
+		b, err := io.ReadAll(wrapResponse(resp, nil, newRangeResumer(doer, resp, 3)).Body)
+		Expect(err).To(Equal(errReset))
+		Expect(string(b)).To(Equal(data[:5]))
+	})
+
+	It("gives up if the range belongs to a resource of another length", func() {
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header:     http.Header{"Content-Range": {"bytes 5-11/12"}},
+			Body:       io.NopCloser(strings.NewReader(data[5:] + "!")),
+		}, nil)
+
+		resp := brokenResp(http.Header{"Etag": {`"v1"`}})
+		b, err := io.ReadAll(wrapResponse(resp, nil, newRangeResumer(doer, resp, 1)).Body)
+		Expect(err).To(Equal(errReset))
+		Expect(string(b)).To(Equal(data[:5]))
+	})
+
+	It("responses without strong validator are not resumable", func() {
+		const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+		Expect(newRangeResumer(doer, brokenResp(http.Header{"Etag": {`W/"v1"`}}), 1)).To(BeNil())
+		Expect(newRangeResumer(doer, brokenResp(http.Header{"Etag": {`W/"v1"`}, "Last-Modified": {lastModified}, "Date": {"Tue, 03 Jan 2006 15:04:05 GMT"}}), 1)).To(BeNil())
+		Expect(newRangeResumer(doer, brokenResp(http.Header{}), 1)).To(BeNil())
+		Expect(newRangeResumer(doer, brokenResp(http.Header{"Last-Modified": {lastModified}}), 1)).To(BeNil())
+		Expect(newRangeResumer(doer, brokenResp(http.Header{"Last-Modified": {lastModified}, "Date": {lastModified}}), 1)).To(BeNil())
+
+		r := newRangeResumer(doer, brokenResp(http.Header{"Last-Modified": {lastModified}, "Date": {"Mon, 02 Jan 2006 15:04:06 GMT"}}), 1)
+		Expect(r).ToNot(BeNil())
+		Expect(r.ifRange).To(Equal(lastModified))
+
+		resp := brokenResp(http.Header{"Etag": {`"v1"`}})
+		resp.ContentLength = -1
+		Expect(newRangeResumer(doer, resp, 1)).To(BeNil())
+	})
+})
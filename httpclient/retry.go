@@ -0,0 +1,228 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseBackoff = 100 * time.Millisecond
+	defaultMaxBackoff  = 10 * time.Second
+	// defaultMaxRetryAfter caps Retry-After for requests without deadline
+	defaultMaxRetryAfter = 30 * time.Second
+
+	// maxDrainBytes bounds how much of a retried response is read to let
+	// its connection be reused, larger bodies just get their conn closed.
+	maxDrainBytes = 4 << 10
+)
+
+var defaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryOption configures a retryDoer.
+type RetryOption func(*retryDoer)
+
+// WithMaxAttempts sets how many times a request is sent at most.
+func WithMaxAttempts(n int) RetryOption {
+	return func(rd *retryDoer) {
+		rd.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled on every
+// further retry up to max.
+func WithBackoff(base, max time.Duration) RetryOption {
+	return func(rd *retryDoer) {
+		rd.baseBackoff = base
+		rd.maxBackoff = max
+	}
+}
+
+// WithMaxRetryAfter caps the delay asked for by a Retry-After header.
+func WithMaxRetryAfter(d time.Duration) RetryOption {
+	return func(rd *retryDoer) {
+		rd.maxRetryAfter = d
+	}
+}
+
+// WithRetryStatus sets the response status codes that are retried.
+func WithRetryStatus(codes ...int) RetryOption {
+	return func(rd *retryDoer) {
+		rd.retryStatus = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			rd.retryStatus[code] = true
+		}
+	}
+}
+
+var (
+	_ HTTPRequestDoer = (*retryDoer)(nil)
+)
+
+// retryDoer resends requests failing with a network error or a retryable
+// status. Put it below a CachedHTTPClient so coalesced waiters share the
+// retried request.
+type retryDoer struct {
+	doer          HTTPRequestDoer
+	maxAttempts   int
+	baseBackoff   time.Duration
+	maxBackoff    time.Duration
+	maxRetryAfter time.Duration
+	retryStatus   map[int]bool
+}
+
+func NewRetryDoer(doer HTTPRequestDoer, opts ...RetryOption) *retryDoer {
+	rd := &retryDoer{
+		doer:          doer,
+		maxAttempts:   defaultMaxAttempts,
+		baseBackoff:   defaultBaseBackoff,
+		maxBackoff:    defaultMaxBackoff,
+		maxRetryAfter: defaultMaxRetryAfter,
+	}
+	WithRetryStatus(defaultRetryStatus...)(rd)
+	for _, opt := range opts {
+		opt(rd)
+	}
+	return rd
+}
+
+// Do sends req, retrying it only if it is idempotent. Retries never wait
+// past the deadline of the request context.
+func (rd *retryDoer) Do(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) {
+		return rd.doer.Do(req)
+	}
+	req, release := EnableBodyReplay(req)
+	defer release()
+
+	ctx := req.Context()
+	r := req
+	for attempt := 1; ; attempt++ {
+		resp, err := rd.doer.Do(r)
+		if attempt >= rd.maxAttempts || !rd.shouldRetry(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := rd.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp); ok {
+				wait = d
+				if wait > rd.maxRetryAfter {
+					wait = rd.maxRetryAfter
+				}
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, gerr := req.GetBody()
+			if gerr != nil {
+				return resp, err
+			}
+			next.Body = body
+		}
+		if resp != nil && resp.Body != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+			resp.Body.Close()
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			if next.Body != nil {
+				next.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		r = next
+	}
+}
+
+func (rd *retryDoer) shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return isNetworkError(err)
+	}
+	return rd.retryStatus[resp.StatusCode]
+}
+
+// isNetworkError reports whether err is a transport failure worth another
+// attempt. Errors of the request itself, like a bad URL, a rejected
+// certificate or a redirect policy, are not, and neither is cancellation.
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// *url.Error implements net.Error itself, so look at what it wraps
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// backoff returns the delay before retry number attempt, with equal jitter.
+func (rd *retryDoer) backoff(attempt int) time.Duration {
+	d := rd.baseBackoff
+	for i := 1; i < attempt && d < rd.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > rd.maxBackoff {
+		d = rd.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// retryAfter parses the Retry-After header, in seconds or as HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// isIdempotent reports whether req may be sent more than once, following
+// RFC 9110 section 9.2.2 or an Idempotency-Key header.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
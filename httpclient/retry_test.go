@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("retryDoer", func() {
+	var (
+		doer    *MockHTTPRequestDoer
+		errConn error = &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{
+			Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+		}}
+	)
+
+	respond := func(status int, header http.Header) *http.Response {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader("x"))}
+	}
+
+	BeforeEach(func() {
+		doer = NewMockHTTPRequestDoer(mockCtrl)
+	})
+
+	It("retries network errors and retryable status codes", func() {
+		gomock.InOrder(
+			doer.EXPECT().Do(gomock.Any()).Return(nil, errConn),
+			doer.EXPECT().Do(gomock.Any()).Return(respond(503, nil), nil),
+			doer.EXPECT().Do(gomock.Any()).Return(respond(200, nil), nil),
+		)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		resp, err := NewRetryDoer(doer, WithBackoff(time.Millisecond, time.Millisecond)).Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+
+	DescribeTable("does not retry errors other than network failures",
+		func(err error) {
+			doer.EXPECT().Do(gomock.Any()).Return(nil, err)
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			_, got := NewRetryDoer(doer, WithBackoff(time.Millisecond, time.Millisecond)).Do(req)
+			Expect(got).To(Equal(err))
+		},
+		Entry("panic", fmt.Errorf("%w: boom", ErrDoerPanic)),
+		Entry("redirect policy", &url.Error{Op: "Get", URL: "http://example.com", Err: errors.New("stopped after 10 redirects")}),
+		Entry("canceled", &url.Error{Op: "Get", URL: "http://example.com", Err: context.Canceled}),
+		Entry("deadline", context.DeadlineExceeded),
+	)
+
+	It("retries truncated responses and resets", func() {
+		gomock.InOrder(
+			doer.EXPECT().Do(gomock.Any()).Return(nil, io.ErrUnexpectedEOF),
+			doer.EXPECT().Do(gomock.Any()).Return(nil, &url.Error{Op: "Get", URL: "http://example.com", Err: syscall.ECONNRESET}),
+			doer.EXPECT().Do(gomock.Any()).Return(respond(200, nil), nil),
+		)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		resp, err := NewRetryDoer(doer, WithBackoff(time.Millisecond, time.Millisecond)).Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+
+	It("returns the last result once attempts are used up", func() {
+		doer.EXPECT().Do(gomock.Any()).Return(respond(502, nil), nil).Times(2)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		resp, err := NewRetryDoer(doer, WithMaxAttempts(2), WithBackoff(time.Millisecond, time.Millisecond)).Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(502))
+	})
+
+	It("retries POST only with an Idempotency-Key and replays its body", func() {
+		newPost := func() *http.Request {
+			req, _ := http.NewRequest("POST", "http://example.com", nil)
+			req.Body = io.NopCloser(strings.NewReader("payload"))
+			return req
+		}
+		rd := NewRetryDoer(doer, WithBackoff(time.Millisecond, time.Millisecond))
+
+		doer.EXPECT().Do(gomock.Any()).Return(nil, errConn)
+		_, err := rd.Do(newPost())
+		Expect(err).To(Equal(errConn))
+
+		var bodies []string
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(req.Body)
+			req.Body.Close()
+			bodies = append(bodies, string(b))
+			if len(bodies) == 1 {
+				return nil, errConn
+			}
+			return respond(200, nil), nil
+		}).Times(2)
+		req := newPost()
+		req.Header.Set("Idempotency-Key", "abc")
+		resp, err := rd.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(bodies).To(Equal([]string{"payload", "payload"}))
+		Expect(req.GetBody).To(BeNil())
+	})
+
+	It("honours Retry-After", func() {
+		started := time.Now()
+		gomock.InOrder(
+			doer.EXPECT().Do(gomock.Any()).Return(respond(429, http.Header{"Retry-After": {"1"}}), nil),
+			doer.EXPECT().Do(gomock.Any()).Return(respond(200, nil), nil),
+		)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		_, err := NewRetryDoer(doer, WithBackoff(time.Millisecond, time.Millisecond)).Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(started)).To(BeNumerically(">=", time.Second))
+	})
+
+	It("caps the delay asked for by Retry-After", func() {
+		started := time.Now()
+		gomock.InOrder(
+			doer.EXPECT().Do(gomock.Any()).Return(respond(503, http.Header{"Retry-After": {"86400"}}), nil),
+			doer.EXPECT().Do(gomock.Any()).Return(respond(200, nil), nil),
+		)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		_, err := NewRetryDoer(doer, WithMaxRetryAfter(time.Millisecond*10)).Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(started)).To(BeNumerically("<", time.Second*5))
+	})
+
+	It("does not wait past the context deadline", func() {
+		doer.EXPECT().Do(gomock.Any()).Return(respond(429, http.Header{"Retry-After": {"60"}}), nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com", nil)
+		resp, err := NewRetryDoer(doer).Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(429))
+	})
+
+	It("coalesced waiters of CachedHTTPClient share one retried request", func() {
+		gomock.InOrder(
+			doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+				time.Sleep(time.Millisecond * 50)
+				return nil, errConn
+			}),
+			doer.EXPECT().Do(gomock.Any()).Return(respond(200, nil), nil),
+		)
+		client := NewCachedHTTPClient(NewMemcacheImpl(simpleGetCacheKey),
+			NewRetryDoer(doer, WithBackoff(time.Millisecond, time.Millisecond)))
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+			}()
+		}
+		wg.Wait()
+	})
+})
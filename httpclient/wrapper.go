@@ -3,7 +3,6 @@ package httpclient
 import (
 	"bufio"
 	"bytes"
-	"io"
 	"net/http"
 	"net/http/httputil"
 
@@ -27,7 +26,11 @@ func cloneResponse(origin http.Response) *http.Response {
 	return resp
 }
 
-func wrapResponse(resp *http.Response) *http.Response {
+// wrapResponse makes resp.Body repeatable. onBodyError, if non-nil, is
+// called once if the body ends with anything but a clean io.EOF, including
+// a body shorter than its Content-Length. If resumer is non-nil, a body
+// failing midway is continued through Range requests.
+func wrapResponse(resp *http.Response, onBodyError func(error), resumer *rangeResumer) *http.Response {
 	if resp == nil || resp.Body == nil {
 		return resp
 	}
@@ -36,10 +39,35 @@ func wrapResponse(resp *http.Response) *http.Response {
 		return resp
 	}
 
-	onEof := func(fullBody io.Reader, err error) {
-		// close origin body from net/http
-		defer resp.Body.Close()
+	// the wrapper closes the origin body from net/http, or the one of the
+	// last resumed request, once it completes
+	onComplete := func(c buffer.Completion) {
+		if c.Cause != buffer.CompletedEOF && onBodyError != nil {
+			onBodyError(c.Err)
+		}
+	}
+	opts := []buffer.StreamWrapperOption{buffer.WithSizeHint(resp.ContentLength)}
+	if hasBodyOfLength(resp) {
+		opts = append(opts, buffer.WithExpectedLength(resp.ContentLength))
+	}
+	if opt, ok := digestOption(resp); ok {
+		opts = append(opts, opt)
+	}
+	if resumer != nil {
+		opts = append(opts, buffer.WithResume(resumer.resume))
 	}
-	resp.Body = buffer.NewRepeatableStreamWrapper(resp.Body, onEof)
+	resp.Body = buffer.NewRepeatableStreamWrapper(resp.Body, onComplete, opts...)
 	return resp
 }
+
+// hasBodyOfLength reports whether resp.Body is expected to carry exactly
+// resp.ContentLength bytes.
+func hasBodyOfLength(resp *http.Response) bool {
+	if resp.ContentLength < 0 || resp.Uncompressed || resp.Body == http.NoBody {
+		return false
+	}
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type closeNotifier struct {
+	io.ReadCloser
+	closed chan struct{}
+}
+
+func (c closeNotifier) Close() error {
+	close(c.closed)
+	return c.ReadCloser.Close()
+}
+
+// newTestResp returns a 200 response reading body, a nil header is
+// replaced by an empty one.
+func newTestResp(body io.Reader, contentLength int64, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode:    200,
+		Header:        header,
+		ContentLength: contentLength,
+		Body:          io.NopCloser(body),
+	}
+}
+
+var _ = Describe("wrapResponse", func() {
+	It("body shorter than Content-Length is reported as unexpected EOF", func() {
+		var bodyErr error
+		resp := wrapResponse(newTestResp(strings.NewReader("hello"), 10, nil), func(err error) { bodyErr = err }, nil)
+		b, err := io.ReadAll(resp.Body)
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		Expect(string(b)).To(Equal("hello"))
+		Expect(bodyErr).To(Equal(io.ErrUnexpectedEOF))
+	})
+
+	It("complete or unknown length bodies end cleanly", func() {
+		for _, cl := range []int64{5, -1} {
+			called := false
+			resp := wrapResponse(newTestResp(strings.NewReader("hello"), cl, nil), func(error) { called = true }, nil)
+			b, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("hello"))
+			Expect(called).To(BeFalse())
+		}
+	})
+
+	It("origin body is closed once every consumer abandoned it", func() {
+		closed := make(chan struct{})
+		resp := newTestResp(strings.NewReader("hello"), 5, nil)
+		resp.Body = closeNotifier{ReadCloser: resp.Body, closed: closed}
+		wrapped := wrapResponse(resp, nil, nil)
+
+		fork := cloneResponse(*wrapped).Body
+		wrapped.Body.Close()
+		Expect(closed).ToNot(BeClosed())
+		fork.Close()
+		Expect(closed).To(BeClosed())
+	})
+
+	It("HEAD responses are not checked against Content-Length", func() {
+		resp := newTestResp(strings.NewReader(""), 10, nil)
+		resp.Request, _ = http.NewRequest(http.MethodHead, "http://example.com", nil)
+		_, err := io.ReadAll(wrapResponse(resp, nil, nil).Body)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("truncated responses are evicted from the cache", func() {
+		cache := NewMemcacheImpl(simpleGetCacheKey)
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		ci, waiter, _ := cache.TryRegister(req)
+		defer waiter.Close()
+
+		resp := newTestResp(strings.NewReader("hello"), 10, nil)
+		resp.Request = req
+		ci.Resolve(resp, nil)
+		Expect(cache.items).To(HaveLen(1))
+
+		got, err := waiter.WaitForResolved(req.Context())
+		Expect(err).ToNot(HaveOccurred())
+		_, err = io.ReadAll(got.Body)
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		Expect(cache.items).To(BeEmpty())
+	})
+})
@@ -0,0 +1,57 @@
+package buffer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// benchmarkConcurrentForks appends to a buffer while many forks busy-read
+// it concurrently until they have seen every byte.
+func benchmarkConcurrentForks(b *testing.B, newBuffer func() RepeatableBuffer, forks int) {
+	const (
+		chunk = 4096
+		total = 4 << 20
+	)
+	data := make([]byte, chunk)
+	b.SetBytes(total * int64(forks))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		rb := newBuffer()
+		var wg sync.WaitGroup
+		wg.Add(forks)
+		for j := 0; j < forks; j++ {
+			fork := rb.Fork()
+			go func() {
+				defer wg.Done()
+				p := make([]byte, chunk)
+				for read := 0; read < total; {
+					n, _ := fork.Read(p)
+					read += n
+				}
+			}()
+		}
+		for written := 0; written < total; written += chunk {
+			rb.Write(data)
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkConcurrentForks(b *testing.B) {
+	impls := []struct {
+		name      string
+		newBuffer func() RepeatableBuffer
+	}{
+		{"contiguous", func() RepeatableBuffer { return NewRepeatableBuffer() }},
+		{"segmented", func() RepeatableBuffer { return NewSegmentedBuffer(DefaultSegmentSize, nil) }},
+	}
+	for _, forks := range []int{1, 16, 64} {
+		for _, impl := range impls {
+			b.Run(fmt.Sprintf("%s/forks=%d", impl.name, forks), func(b *testing.B) {
+				benchmarkConcurrentForks(b, impl.newBuffer, forks)
+			})
+		}
+	}
+}
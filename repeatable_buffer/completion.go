@@ -0,0 +1,77 @@
+package buffer
+
+import (
+	"io"
+	"time"
+)
+
+// CompletionCause tells why a stream stopped pulling from its source.
+type CompletionCause int
+
+const (
+	// CompletedEOF means the source was read to a clean io.EOF.
+	CompletedEOF CompletionCause = iota
+	// CompletedError means reading, resuming or verifying the source failed.
+	CompletedError
+	// CompletedCanceled means every fork was closed before the source ended.
+	CompletedCanceled
+)
+
+func (c CompletionCause) String() string {
+	switch c {
+	case CompletedEOF:
+		return "eof"
+	case CompletedError:
+		return "error"
+	case CompletedCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// Completion describes how a stream ended. It is delivered exactly once,
+// after the source has been closed.
+type Completion struct {
+	Cause    CompletionCause
+	Err      error // io.EOF, the failure, or context.Canceled
+	Bytes    int64 // bytes pulled from the source
+	Duration time.Duration
+	// Data reads everything buffered from the beginning.
+	Data RepeatableBufferReader
+}
+
+// closeSource closes the current source if it is an io.Closer. Sources
+// swapped in by a resume afterwards are closed right away.
+func (sw *streamWrapper) closeSource() {
+	sw.srcMu.Lock()
+	r := sw.r
+	sw.srcClosed = true
+	sw.srcMu.Unlock()
+
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// source returns the reader to pull from.
+func (sw *streamWrapper) source() io.Reader {
+	sw.srcMu.Lock()
+	defer sw.srcMu.Unlock()
+
+	return sw.r
+}
+
+// replaceSource swaps in a resumed source, unless the stream completed
+// meanwhile.
+func (sw *streamWrapper) replaceSource(r io.Reader) {
+	sw.srcMu.Lock()
+	closed := sw.srcClosed
+	if !closed {
+		sw.r = r
+	}
+	sw.srcMu.Unlock()
+
+	if c, ok := r.(io.Closer); closed && ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed++
+	return nil
+}
+
+var _ = Describe("completion", func() {
+	var (
+		events []Completion
+		record = func(c Completion) { events = append(events, c) }
+	)
+
+	BeforeEach(func() {
+		events = nil
+	})
+
+	It("reports natural EOF with byte count and closes the source", func() {
+		src := &closeRecorder{Reader: strings.NewReader("hello")}
+		wrapper := NewRepeatableStreamWrapper(src, record)
+		_, err := io.ReadAll(wrapper)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Cause).To(Equal(CompletedEOF))
+		Expect(events[0].Err).To(Equal(io.EOF))
+		Expect(events[0].Bytes).To(Equal(int64(5)))
+		Expect(events[0].Data.String()).To(Equal("hello"))
+		Expect(src.closed).To(Equal(1))
+	})
+
+	It("reports upstream errors", func() {
+		errBroken := errors.New("broken")
+		src := &closeRecorder{Reader: iotest.ErrReader(errBroken)}
+		wrapper := NewRepeatableStreamWrapper(src, record)
+		_, err := io.ReadAll(wrapper)
+		Expect(err).To(Equal(errBroken))
+
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Cause).To(Equal(CompletedError))
+		Expect(events[0].Err).To(Equal(errBroken))
+		Expect(src.closed).To(Equal(1))
+	})
+
+	It("reports cancellation once the last fork is closed and closes the source", func() {
+		src := &closeRecorder{Reader: strings.NewReader("hello")}
+		wrapper := NewRepeatableStreamWrapper(src, record)
+		fork := wrapper.Fork()
+		wrapper.Close()
+		Expect(events).To(BeEmpty())
+		fork.Close()
+
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Cause).To(Equal(CompletedCanceled))
+		Expect(events[0].Err).To(Equal(context.Canceled))
+		Expect(src.closed).To(Equal(1))
+	})
+})
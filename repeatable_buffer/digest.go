@@ -0,0 +1,41 @@
+package buffer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ErrDigestMismatch is returned to every fork instead of io.EOF if the data
+// read from the source does not match the expected digest.
+var ErrDigestMismatch = errors.New("buffer: digest mismatch")
+
+type digest struct {
+	h        hash.Hash
+	expected []byte
+}
+
+// WithDigest hashes the full source with h as it is pulled and compares the
+// sum against expected once the source reaches io.EOF.
+func WithDigest(h hash.Hash, expected []byte) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		sw.digests = append(sw.digests, digest{h: h, expected: expected})
+	}
+}
+
+// WithSHA256 is WithDigest using SHA-256.
+func WithSHA256(expected []byte) StreamWrapperOption {
+	return WithDigest(sha256.New(), expected)
+}
+
+// verifyDigests compares the sums once the source is exhausted.
+func (sw *streamWrapper) verifyDigests() error {
+	for _, d := range sw.digests {
+		if sum := d.h.Sum(nil); !bytes.Equal(sum, d.expected) {
+			return fmt.Errorf("%w: got %x, want %x", ErrDigestMismatch, sum, d.expected)
+		}
+	}
+	return nil
+}
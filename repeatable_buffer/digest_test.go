@@ -0,0 +1,39 @@
+package buffer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("digest", func() {
+	data := []byte(RandomString(32 * 1024))
+	sha := sha256.Sum256(data)
+	md := md5.Sum(data)
+
+	It("matching digests end the stream with io.EOF", func() {
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader(data), nil,
+			WithSHA256(sha[:]), WithDigest(md5.New(), md[:]))
+		b, err := io.ReadAll(wrapper)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(Equal(data))
+	})
+
+	It("corrupt data surfaces ErrDigestMismatch to every fork", func() {
+		corrupt := append([]byte(nil), data...)
+		corrupt[100] ^= 0xff
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader(corrupt), nil, WithSHA256(sha[:]))
+		fork := wrapper.Fork()
+
+		_, err := io.ReadAll(wrapper)
+		Expect(errors.Is(err, ErrDigestMismatch)).To(BeTrue())
+		b, err := io.ReadAll(fork)
+		Expect(errors.Is(err, ErrDigestMismatch)).To(BeTrue())
+		Expect(b).To(Equal(corrupt))
+	})
+})
@@ -0,0 +1,101 @@
+package buffer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket limiting throughput to a number of bytes per
+// second, allowing bursts of up to burst bytes. Limits can be changed at
+// any time, also while streams are using the limiter, and a single Limiter
+// may be shared by several forks or streams. A non-positive rate disables
+// limiting.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter whose bucket starts out full.
+func NewLimiter(bytesPerSec float64, burst int) *Limiter {
+	l := &Limiter{}
+	l.SetLimit(bytesPerSec, burst)
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// SetLimit changes the rate and burst, keeping the tokens accumulated so
+// far up to the new burst.
+func (l *Limiter) SetLimit(bytesPerSec float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance(time.Now())
+	if burst <= 0 {
+		burst = 1
+	}
+	l.rate, l.burst = bytesPerSec, burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+}
+
+// Burst returns the largest chunk that should be passed at once, or 0 if
+// the limiter is disabled.
+func (l *Limiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+	return l.burst
+}
+
+// Reserve takes n bytes from the bucket, going into debt if needed, and
+// returns how long the caller has to wait before passing them on.
+func (l *Limiter) Reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+	l.advance(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// WaitN blocks until n bytes may pass, or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	d := l.Reserve(n)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// caller must hold l.mu.
+func (l *Limiter) advance(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
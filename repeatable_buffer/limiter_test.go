@@ -0,0 +1,118 @@
+package buffer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	data := []byte(RandomString(40 * 1024))
+
+	It("bursts are free, then throughput is limited", func() {
+		l := NewLimiter(100*1024, 10*1024)
+		l.Reserve(10 * 1024) // drain initial bucket
+		start := time.Now()
+		Expect(l.WaitN(context.Background(), 10*1024)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">", 90*time.Millisecond))
+	})
+
+	It("non-positive rate disables limiting", func() {
+		l := NewLimiter(0, 1)
+		Expect(l.Burst()).To(Equal(0))
+		Expect(l.Reserve(1 << 20)).To(BeZero())
+	})
+
+	It("wait can be abandoned", func() {
+		l := NewLimiter(1, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(l.WaitN(ctx, 100)).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("limits fork egress without slowing other forks", func() {
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader(data), nil)
+		slow := wrapper.Fork()
+		slow.SetLimiter(NewLimiter(200*1024, 8*1024))
+
+		start := time.Now()
+		slowDone := make(chan []byte)
+		go func() {
+			b, _ := io.ReadAll(slow)
+			slowDone <- b
+		}()
+
+		b, err := io.ReadAll(wrapper)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(Equal(data))
+		Expect(slowDone).ToNot(Receive())
+
+		Expect(<-slowDone).To(Equal(data))
+		Expect(time.Since(start)).To(BeNumerically(">", 150*time.Millisecond))
+	})
+
+	It("limits source ingress and can be changed at runtime", func() {
+		l := NewLimiter(200*1024, 8*1024)
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader(data), nil, WithSourceLimiter(l))
+
+		start := time.Now()
+		_, err := io.ReadFull(wrapper, make([]byte, 20*1024))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">", 50*time.Millisecond))
+
+		// throttled at this rate the rest would take over 10s
+		l.SetLimit(1024, 8*1024)
+		wrapper.SetSourceLimiter(nil)
+		start = time.Now()
+		b, err := io.ReadAll(wrapper)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(HaveLen(20 * 1024))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	Context("a pull waiting on the source limiter", func() {
+		var (
+			wrapper *streamWrapper
+			fork    *streamWrapperFork
+			pulled  chan struct{}
+		)
+
+		BeforeEach(func() {
+			// the first chunk drains the bucket, the second waits for hours
+			wrapper = NewRepeatableStreamWrapper(bytes.NewReader(data), nil, WithSourceLimiter(NewLimiter(1, 4096)))
+			fork = wrapper.Fork()
+			_, err := io.ReadFull(fork, make([]byte, 4096))
+			Expect(err).ToNot(HaveOccurred())
+
+			pulled = make(chan struct{})
+			go func() {
+				defer close(pulled)
+				fork.Read(make([]byte, 1))
+			}()
+			Eventually(func() bool {
+				wrapper.throttleMu.Lock()
+				defer wrapper.throttleMu.Unlock()
+				return wrapper.stopThrottle != nil
+			}).Should(BeTrue())
+		})
+
+		It("is released when the last fork closes", func() {
+			wrapper.Close()
+			fork.Close()
+			Eventually(pulled).Should(BeClosed())
+		})
+
+		It("is released when the source limiter is removed", func() {
+			wrapper.SetSourceLimiter(nil)
+			Eventually(pulled).Should(BeClosed())
+			wrapper.Close()
+			b, err := io.ReadAll(fork)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(HaveLen(len(data) - 4096 - 1))
+		})
+	})
+})
@@ -0,0 +1,220 @@
+package buffer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// MessageSource yields the messages of a stream one at a time, returning
+// io.EOF after the last one. If it is an io.Closer, it is closed once the
+// stream ends.
+type MessageSource[T any] interface {
+	Next() (T, error)
+}
+
+// MessageSourceFunc adapts a function to a MessageSource.
+type MessageSourceFunc[T any] func() (T, error)
+
+func (f MessageSourceFunc[T]) Next() (T, error) { return f() }
+
+// RepeatableMessageStream is the typed counterpart of RepeatableStreamWrapper
+// for streams of discrete messages, e.g. SSE events or decoded records.
+type RepeatableMessageStream[T any] interface {
+	Next() (T, error)
+	NextContext(ctx context.Context) (T, error)
+	Fork() *messageStreamFork[T]
+	Close() error
+}
+
+var (
+	_ RepeatableMessageStream[any] = (*messageStream[any])(nil)
+	_ RepeatableMessageStream[any] = (*messageStreamFork[any])(nil)
+)
+
+// messageStream lazily pulls messages from its source and keeps all of
+// them, so each fork sees the whole stream from the beginning. Like
+// streamWrapper, whichever fork runs out of messages first pulls the next
+// one for everybody, and the stream is canceled once its last fork closes.
+type messageStream[T any] struct {
+	src  MessageSource[T]
+	fork *messageStreamFork[T]
+
+	mu   sync.RWMutex // guards msgs
+	msgs []T
+
+	rerr      atomic.Pointer[error] // sticky error, set once
+	tryReadCh chan struct{}
+	notifier  notifier
+	children  atomic.Int32
+}
+
+func NewRepeatableMessageStream[T any](src MessageSource[T]) *messageStream[T] {
+	ms := &messageStream[T]{
+		src:       src,
+		tryReadCh: make(chan struct{}, 1),
+	}
+	ms.fork = ms.Fork()
+	return ms
+}
+
+func (ms *messageStream[T]) err() error {
+	if p := ms.rerr.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+func (ms *messageStream[T]) finish(err error) {
+	if !ms.rerr.CompareAndSwap(nil, &err) {
+		return
+	}
+	ms.notifier.CloseAll()
+	if c, ok := ms.src.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func (ms *messageStream[T]) doRead() {
+	if ms.err() != nil {
+		return
+	}
+	msg, err := ms.src.Next()
+	if err != nil {
+		ms.finish(err)
+		return
+	}
+	ms.mu.Lock()
+	ms.msgs = append(ms.msgs, msg)
+	n := len(ms.msgs)
+	ms.mu.Unlock()
+	ms.notifier.Notify(n)
+}
+
+// at returns the i-th message, if already pulled.
+func (ms *messageStream[T]) at(i int) (msg T, ok bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if i < len(ms.msgs) {
+		return ms.msgs[i], true
+	}
+	return msg, false
+}
+
+func (ms *messageStream[T]) Next() (T, error) {
+	return ms.fork.Next()
+}
+
+func (ms *messageStream[T]) NextContext(ctx context.Context) (T, error) {
+	return ms.fork.NextContext(ctx)
+}
+
+func (ms *messageStream[T]) Fork() *messageStreamFork[T] {
+	ms.children.Add(1)
+	return &messageStreamFork[T]{
+		origin:        ms,
+		sub:           ms.notifier.Register(),
+		localClosedCh: make(chan struct{}),
+	}
+}
+
+func (ms *messageStream[T]) cancel() {
+	ms.finish(context.Canceled)
+}
+
+func (ms *messageStream[T]) Close() error {
+	return ms.fork.Close()
+}
+
+type messageStreamFork[T any] struct {
+	origin *messageStream[T]
+	off    int
+	sub    *subscription
+
+	localClosed   atomic.Bool
+	localClosedCh chan struct{}
+}
+
+// Next returns the next message, or the stream's terminal error (io.EOF
+// after the last message) once the fork has seen every message.
+func (msf *messageStreamFork[T]) Next() (T, error) {
+	return msf.NextContext(context.Background())
+}
+
+// NextContext is like Next but gives up waiting for the source once ctx is
+// done, without affecting other forks.
+func (msf *messageStreamFork[T]) NextContext(ctx context.Context) (msg T, err error) {
+	if msf.localClosed.Load() {
+		return msg, io.EOF
+	}
+
+	origin := msf.origin
+	for {
+		if msg, ok := origin.at(msf.off); ok {
+			msf.off++
+			return msg, nil
+		}
+		if rerr := origin.err(); rerr != nil {
+			if msg, ok := origin.at(msf.off); ok {
+				msf.off++
+				return msg, nil
+			}
+			return msg, rerr
+		}
+		if err := msf.wait(ctx); err != nil {
+			return msg, err
+		}
+	}
+}
+
+// wait blocks until another message may be available, pulling it from the
+// source itself if no other fork is doing so.
+func (msf *messageStreamFork[T]) wait(ctx context.Context) error {
+	origin := msf.origin
+	select {
+	case <-msf.localClosedCh:
+		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
+	case origin.tryReadCh <- struct{}{}:
+	case <-msf.sub.WaitLength(msf.off + 1):
+		return nil
+	}
+
+	if ctx.Done() == nil {
+		origin.doRead()
+		<-origin.tryReadCh
+		return nil
+	}
+	pulled := make(chan struct{})
+	go func() {
+		defer close(pulled)
+		origin.doRead()
+		<-origin.tryReadCh
+	}()
+	select {
+	case <-pulled:
+		return nil
+	case <-msf.localClosedCh:
+		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (msf *messageStreamFork[T]) Close() error {
+	if ok := msf.localClosed.CompareAndSwap(false, true); ok {
+		close(msf.localClosedCh)
+		msf.origin.notifier.Unregister(msf.sub)
+		if new := msf.origin.children.Add(-1); new == 0 {
+			msf.origin.cancel()
+		}
+	}
+	return nil
+}
+
+func (msf *messageStreamFork[T]) Fork() *messageStreamFork[T] {
+	return msf.origin.Fork()
+}
@@ -0,0 +1,107 @@
+package buffer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type event struct {
+	ID   int
+	Data string
+}
+
+var _ = Describe("messageStream", func() {
+	newSource := func(n int) (MessageSource[event], *int) {
+		pulled := 0
+		return MessageSourceFunc[event](func() (event, error) {
+			if pulled == n {
+				return event{}, io.EOF
+			}
+			pulled++
+			return event{ID: pulled, Data: RandomString(8)}, nil
+		}), &pulled
+	}
+	drain := func(s RepeatableMessageStream[event]) []event {
+		var out []event
+		for {
+			msg, err := s.Next()
+			if err != nil {
+				Expect(err).To(Equal(io.EOF))
+				return out
+			}
+			out = append(out, msg)
+		}
+	}
+
+	It("pulls lazily and replays to every fork from the beginning", func() {
+		src, pulled := newSource(100)
+		stream := NewRepeatableMessageStream(src)
+		Expect(*pulled).To(BeZero())
+
+		first, err := stream.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first.ID).To(Equal(1))
+		Expect(*pulled).To(Equal(1))
+
+		fork := stream.Fork()
+		all := drain(fork)
+		Expect(all).To(HaveLen(100))
+		Expect(all[0]).To(Equal(first))
+		Expect(drain(stream)).To(Equal(all[1:]))
+	})
+
+	It("concurrent forks see identical streams", func() {
+		src, _ := newSource(1000)
+		stream := NewRepeatableMessageStream(src)
+		defer stream.Close()
+
+		N := 10
+		results := make([][]event, N)
+		var wg sync.WaitGroup
+		wg.Add(N)
+		for i := 0; i < N; i++ {
+			fork := stream.Fork()
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				defer fork.Close()
+				results[i] = drain(fork)
+			}(i)
+		}
+		wg.Wait()
+		for i := 1; i < N; i++ {
+			Expect(results[i]).To(Equal(results[0]))
+		}
+	})
+
+	It("is canceled once the last fork closes", func() {
+		src, _ := newSource(10)
+		stream := NewRepeatableMessageStream(src)
+		fork := stream.Fork()
+		stream.Close()
+		fork.Close()
+
+		_, err := stream.Fork().Next()
+		Expect(err).To(Equal(context.Canceled))
+	})
+
+	It("waits can be abandoned through context", func() {
+		block := make(chan struct{})
+		stream := NewRepeatableMessageStream[int](MessageSourceFunc[int](func() (int, error) {
+			<-block
+			return 1, nil
+		}))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := stream.NextContext(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
+		close(block)
+		Expect(stream.Fork().Next()).To(Equal(1))
+	})
+})
@@ -0,0 +1,137 @@
+package buffer
+
+import (
+	"math"
+	"sync"
+)
+
+// notifier wakes up readers waiting for a stream to advance. It works like
+// a condition variable: the writer publishes the new length and bumps a
+// generation counter on every Notify, and each subscription states what it
+// is waiting for. The condition is checked again when a subscription is
+// armed, so a Notify racing with a reader that is about to park is never
+// lost.
+type notifier struct {
+	mu     sync.Mutex
+	gen    uint64
+	length int
+	closed bool
+	subs   map[*subscription]struct{}
+}
+
+type subscription struct {
+	n  *notifier
+	ch chan struct{} // holds at most one pending wakeup, closed by CloseAll
+
+	// guarded by n.mu
+	armed    bool
+	minLen   int
+	sinceGen uint64
+}
+
+// Register returns a new subscription, which must be handed back with
+// Unregister once its owner is done.
+func (n *notifier) Register() *subscription {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := &subscription{n: n, ch: make(chan struct{}, 1)}
+	if n.closed {
+		close(s.ch)
+		return s
+	}
+	if n.subs == nil {
+		n.subs = make(map[*subscription]struct{})
+	}
+	n.subs[s] = struct{}{}
+	return s
+}
+
+func (n *notifier) Unregister(s *subscription) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.subs, s)
+}
+
+// Generation returns the number of Notify calls so far.
+func (n *notifier) Generation() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.gen
+}
+
+// Notify publishes the current length of the stream and wakes up the
+// subscriptions whose condition now holds.
+func (n *notifier) Notify(length int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return
+	}
+	n.gen++
+	n.length = length
+	for s := range n.subs {
+		if s.armed && n.ready(s) {
+			s.fire()
+		}
+	}
+}
+
+// CloseAll wakes up every current and future wait for good.
+func (n *notifier) CloseAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return
+	}
+	n.closed = true
+	for s := range n.subs {
+		close(s.ch)
+	}
+	n.subs = nil
+}
+
+// caller must hold n.mu.
+func (n *notifier) ready(s *subscription) bool {
+	return n.length >= s.minLen || n.gen > s.sinceGen
+}
+
+// caller must hold n.mu and n must not be closed.
+func (s *subscription) fire() {
+	s.armed = false
+	select {
+	case s.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) arm(minLen int, sinceGen uint64) <-chan struct{} {
+	n := s.n
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return s.ch
+	}
+	s.armed, s.minLen, s.sinceGen = true, minLen, sinceGen
+	if n.ready(s) {
+		s.fire()
+	}
+	return s.ch
+}
+
+// WaitLength returns a channel that receives once the published length is
+// at least min, or is closed once the notifier is.
+func (s *subscription) WaitLength(min int) <-chan struct{} {
+	return s.arm(min, math.MaxUint64)
+}
+
+// WaitChange returns a channel that receives once Notify was called after
+// generation gen was observed, or is closed once the notifier is.
+func (s *subscription) WaitChange(gen uint64) <-chan struct{} {
+	return s.arm(math.MaxInt, gen)
+}
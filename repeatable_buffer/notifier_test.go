@@ -0,0 +1,46 @@
+package buffer
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("notifier", func() {
+	var n *notifier
+
+	BeforeEach(func() {
+		n = &notifier{}
+	})
+
+	It("wakes up only once the wanted length is reached", func() {
+		s := n.Register()
+		ch := s.WaitLength(10)
+		n.Notify(5)
+		Consistently(ch).ShouldNot(Receive())
+		n.Notify(10)
+		Eventually(ch).Should(Receive())
+	})
+
+	It("does not lose a notify happening before the wait is armed", func() {
+		s := n.Register()
+		gen := n.Generation()
+		n.Notify(5)
+		Eventually(s.WaitChange(gen)).Should(Receive())
+		Eventually(s.WaitLength(5)).Should(Receive())
+	})
+
+	It("unregistered subscriptions are dropped", func() {
+		s := n.Register()
+		Expect(n.subs).To(HaveLen(1))
+		n.Unregister(s)
+		Expect(n.subs).To(BeEmpty())
+	})
+
+	It("closing wakes up current and future waits", func() {
+		s := n.Register()
+		ch := s.WaitLength(10)
+		n.CloseAll()
+		Expect(ch).To(BeClosed())
+		Expect(n.Register().WaitLength(10)).To(BeClosed())
+	})
+})
@@ -0,0 +1,108 @@
+package buffer
+
+import (
+	"io"
+
+	"github.com/nadoo/glider/pkg/pool"
+)
+
+// maxSizeHint caps the initial allocation made from a size hint, so a bogus
+// Content-Length can not reserve an arbitrary amount of memory up front.
+const maxSizeHint = 64 << 20
+
+// BufferPool supplies scratch buffers used to read from the source.
+type BufferPool interface {
+	Get(size int) []byte
+	Put(buf []byte)
+}
+
+type gliderPool struct{}
+
+func (gliderPool) Get(size int) []byte { return pool.GetBuffer(size) }
+func (gliderPool) Put(buf []byte)      { pool.PutBuffer(buf) }
+
+// GliderBufferPool is a BufferPool backed by glider's sized buffer pools.
+var GliderBufferPool BufferPool = gliderPool{}
+
+type StreamWrapperOption func(*streamWrapper)
+
+// WithChunkSize makes every read from the source request exactly n bytes.
+func WithChunkSize(n int) StreamWrapperOption {
+	return WithAdaptiveChunkSize(n, n)
+}
+
+// WithAdaptiveChunkSize lets the read size float between lo and hi,
+// growing while the source fills whole chunks and shrinking on short reads.
+func WithAdaptiveChunkSize(lo, hi int) StreamWrapperOption {
+	if lo <= 0 || hi < lo {
+		panic("buffer: invalid chunk size range")
+	}
+	return func(sw *streamWrapper) {
+		sw.minChunkSize, sw.maxChunkSize = lo, hi
+	}
+}
+
+// WithBufferPool reads the source into scratch buffers taken from p and
+// copies them into the shared buffer, instead of reading into it directly.
+// Combined with WithSegmentedBuffer, p supplies the segments instead.
+func WithBufferPool(p BufferPool) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		sw.pool = p
+	}
+}
+
+// WithSizeHint preallocates the backing buffer for n bytes, e.g. from a
+// response's Content-Length. Non-positive hints are ignored.
+func WithSizeHint(n int64) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		if n > maxSizeHint {
+			n = maxSizeHint
+		}
+		if n > 0 {
+			sw.sizeHint = int(n)
+		}
+	}
+}
+
+// WithSegmentedBuffer stores the stream in segments of segmentSize bytes
+// rather than one contiguous slice, so large bodies are never copied on
+// growth. The size hint is ignored in this mode.
+func WithSegmentedBuffer(segmentSize int) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		if segmentSize <= 0 {
+			segmentSize = DefaultSegmentSize
+		}
+		sw.segmentSize = segmentSize
+	}
+}
+
+// WithExpectedLength fails the stream with io.ErrUnexpectedEOF if the source
+// ends before n bytes, or with ErrLengthExceeded if it yields more. Negative
+// values mean the length is unknown.
+func WithExpectedLength(n int64) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		sw.expectedLen = n
+	}
+}
+
+// ResumeFunc is called when reading the source fails with cause after off
+// bytes. It returns a reader yielding the source from off onwards, which
+// replaces the failed one, or an error to give up and fail the stream with
+// cause.
+type ResumeFunc func(off int64, cause error) (io.Reader, error)
+
+// WithResume lets the stream recover from source failures through fn.
+// Forks only notice a resumed source as a delay.
+func WithResume(fn ResumeFunc) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		sw.resume = fn
+	}
+}
+
+// WithSourceLimiter limits how fast the source is pulled, see
+// SetSourceLimiter.
+func WithSourceLimiter(l *Limiter) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		sw.limiter.Store(l)
+	}
+}
@@ -1,19 +1,44 @@
 package buffer
 
 import (
+	"errors"
 	"io"
 )
 
 type RepeatableBuffer interface {
 	RepeatableBufferReader
 	Write(p []byte) (n int, err error)
+	FillFrom(r io.Reader, size int) (n int, err error)
 }
 
 type RepeatableBufferReader interface {
 	Bytes() []byte
 	String() string
 	Read(p []byte) (n int, err error)
+	WriteTo(w io.Writer) (n int64, err error)
+	Offset() int
 	Fork() *repeatableBufferFork
+	ForkFromCurrent() *repeatableBufferFork
+	ForkAt(off int) (*repeatableBufferFork, error)
+}
+
+var (
+	// ErrInvalidOffset is returned by ForkAt if the offset is negative or
+	// beyond the bytes already written to the buffer.
+	ErrInvalidOffset = errors.New("buffer: fork offset out of range")
+	// ErrReleased is returned when reading bytes that were already released.
+	ErrReleased = errors.New("buffer: data at offset was released")
+)
+
+// appendOnlyStore is the storage shared by a buffer and its forks.
+// Written bytes are never modified, so slices returned by peek stay valid
+// without holding any lock.
+type appendOnlyStore interface {
+	// peek returns a contiguous run of written bytes starting at off, which
+	// is empty once off reaches the end of the written data.
+	peek(off int) ([]byte, error)
+	// bytesFrom returns all written bytes starting at off.
+	bytesFrom(off int) []byte
 }
 
 var (
@@ -29,46 +54,101 @@ func NewRepeatableBuffer() *repeatableBufferImpl {
 	return &repeatableBufferImpl{}
 }
 
+// NewRepeatableBufferSize returns an empty buffer with capacity for n bytes.
+func NewRepeatableBufferSize(n int) *repeatableBufferImpl {
+	rb := &repeatableBufferImpl{}
+	if n > 0 {
+		rb.buf = make([]byte, 0, n)
+	}
+	return rb
+}
+
 func (rb *repeatableBufferImpl) Fork() *repeatableBufferFork {
 	return newRepeatableBufferFork(&rb.Buffer, 0)
 }
 
+// ForkFromCurrent returns a fork starting at the buffer's current read offset.
+func (rb *repeatableBufferImpl) ForkFromCurrent() *repeatableBufferFork {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+
+	return newRepeatableBufferFork(&rb.Buffer, rb.off)
+}
+
+// ForkAt returns a fork starting at the absolute offset off, which must
+// not exceed the number of bytes written so far.
+func (rb *repeatableBufferImpl) ForkAt(off int) (*repeatableBufferFork, error) {
+	return forkAt(&rb.Buffer, off)
+}
+
+func forkAt(store appendOnlyStore, off int) (*repeatableBufferFork, error) {
+	if off < 0 {
+		return nil, ErrInvalidOffset
+	}
+	if _, err := store.peek(off); err != nil {
+		return nil, err
+	}
+	return newRepeatableBufferFork(store, off), nil
+}
+
 type repeatableBufferFork struct {
-	origin *Buffer
+	origin appendOnlyStore
 	off    int
 }
 
-func newRepeatableBufferFork(buf *Buffer, off int) *repeatableBufferFork {
+func newRepeatableBufferFork(store appendOnlyStore, off int) *repeatableBufferFork {
 	return &repeatableBufferFork{
-		origin: buf,
+		origin: store,
 		off:    off,
 	}
 }
 
-func (rbf *repeatableBufferFork) empty() bool {
-	return len(rbf.origin.buf) <= rbf.off
-}
-
 func (rbf *repeatableBufferFork) Read(p []byte) (n int, err error) {
-	rbf.origin.mu.RLock()
-	defer rbf.origin.mu.RUnlock()
-
-	if rbf.empty() {
+	b, err := rbf.origin.peek(rbf.off)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
 		if len(p) == 0 {
 			return 0, nil
 		}
 		return 0, io.EOF
 	}
-	n = copy(p, rbf.origin.buf[rbf.off:])
+	n = copy(p, b)
 	rbf.off += n
 	return n, nil
 }
 
-func (rbf *repeatableBufferFork) Bytes() []byte {
-	rbf.origin.mu.RLock()
-	defer rbf.origin.mu.RUnlock()
+// WriteTo writes the unread bytes directly from the shared backing slices.
+// Written bytes are never modified, so no lock is held during w.Write.
+func (rbf *repeatableBufferFork) WriteTo(w io.Writer) (n int64, err error) {
+	for {
+		p, err := rbf.origin.peek(rbf.off)
+		if err != nil || len(p) == 0 {
+			return n, err
+		}
+		m, err := w.Write(p)
+		if m > len(p) {
+			panic("buffer.WriteTo: invalid Write count")
+		}
+		rbf.off += m
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+		if m != len(p) {
+			return n, io.ErrShortWrite
+		}
+	}
+}
+
+// Offset returns the absolute offset of the next byte to be read.
+func (rbf *repeatableBufferFork) Offset() int {
+	return rbf.off
+}
 
-	return rbf.origin.buf[rbf.off:]
+func (rbf *repeatableBufferFork) Bytes() []byte {
+	return rbf.origin.bytesFrom(rbf.off)
 }
 
 func (rbf *repeatableBufferFork) String() string {
@@ -78,3 +158,12 @@ func (rbf *repeatableBufferFork) String() string {
 func (rbf *repeatableBufferFork) Fork() *repeatableBufferFork {
 	return newRepeatableBufferFork(rbf.origin, 0)
 }
+
+// ForkFromCurrent returns a fork starting at this fork's current offset.
+func (rbf *repeatableBufferFork) ForkFromCurrent() *repeatableBufferFork {
+	return newRepeatableBufferFork(rbf.origin, rbf.off)
+}
+
+func (rbf *repeatableBufferFork) ForkAt(off int) (*repeatableBufferFork, error) {
+	return forkAt(rbf.origin, off)
+}
@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -50,6 +51,45 @@ var _ = Describe("RepeatableBuffer", func() {
 		Expect("hello" + longStrA + longStrB).To(Equal(readall(fork)))
 	})
 
+	It("fork from current offset or absolute offset", func() {
+		origin := NewRepeatableBuffer()
+		origin.Write([]byte("hello world"))
+
+		fork := origin.Fork()
+		fork.Read(make([]byte, 6))
+		Expect(readall(fork.ForkFromCurrent())).To(Equal("world"))
+
+		origin.Read(make([]byte, 2))
+		Expect(readall(origin.ForkFromCurrent())).To(Equal("llo world"))
+
+		at, err := origin.ForkAt(4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readall(at)).To(Equal("o world"))
+
+		at, err = fork.ForkAt(11)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readall(at)).To(Equal(""))
+
+		_, err = origin.ForkAt(12)
+		Expect(err).To(Equal(ErrInvalidOffset))
+		_, err = origin.ForkAt(-1)
+		Expect(err).To(Equal(ErrInvalidOffset))
+	})
+
+	It("fork writes unread bytes through WriteTo", func() {
+		origin := NewRepeatableBuffer()
+		origin.Write([]byte("hello"))
+		fork := origin.Fork()
+		fork.Read(make([]byte, 1))
+
+		var dst bytes.Buffer
+		n, err := fork.WriteTo(&dst)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(int64(4)))
+		Expect(dst.String()).To(Equal("ello"))
+		Expect(readall(fork)).To(Equal(""))
+	})
+
 	// run test with `ginkgo --race`
 	It("buffer and forks should not race with each other", func() {
 		N := 10
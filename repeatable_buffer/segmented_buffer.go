@@ -0,0 +1,184 @@
+package buffer
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSegmentSize is the segment size used by NewSegmentedBuffer if none
+// is given.
+const DefaultSegmentSize = 64 << 10
+
+var (
+	_ RepeatableBuffer = (*segmentedBuffer)(nil)
+	_ appendOnlyStore  = (*segmentStore)(nil)
+)
+
+// segmentStore keeps written bytes in a list of fixed-size segments, so
+// appending never copies existing data and readers never observe a
+// reallocation. Segments can be released individually once no reader needs
+// them any more.
+//
+// It is built for a single writer and many readers: the writer publishes the
+// segment table and then the committed size atomically, and readers copy
+// committed bytes without taking any lock.
+type segmentStore struct {
+	wmu     sync.Mutex // serializes writers only, readers never take it
+	segSize int
+	pool    BufferPool
+
+	// segs[i] holds bytes [i*segSize, (i+1)*segSize) and is nil once
+	// released. The table is replaced, never modified in place, except for
+	// appends beyond the length published to readers.
+	segs     atomic.Pointer[[][]byte]
+	size     atomic.Int64 // number of committed bytes
+	released atomic.Int64 // bytes below released were handed back
+}
+
+func newSegmentStore(segSize int, pool BufferPool) *segmentStore {
+	s := &segmentStore{
+		segSize: segSize,
+		pool:    pool,
+	}
+	s.segs.Store(new([][]byte))
+	return s
+}
+
+func (s *segmentStore) alloc() []byte {
+	if s.pool != nil {
+		return s.pool.Get(s.segSize)[:s.segSize]
+	}
+	return make([]byte, s.segSize)
+}
+
+// tail returns the unused space of the last segment, publishing a new
+// segment if the last one is full. Caller must hold s.wmu.
+func (s *segmentStore) tail() []byte {
+	size := int(s.size.Load())
+	i, o := size/s.segSize, size%s.segSize
+	segs := s.segs.Load()
+	if i == len(*segs) {
+		next := append(*segs, s.alloc())
+		s.segs.Store(&next)
+		segs = &next
+	}
+	return (*segs)[i][o:]
+}
+
+func (s *segmentStore) peek(off int) ([]byte, error) {
+	// Load order matters: a table is only published after the segments it
+	// covers are allocated, and only after released was advanced past any
+	// segment it no longer holds.
+	size := int(s.size.Load())
+	segs := *s.segs.Load()
+	switch {
+	case off > size:
+		return nil, ErrInvalidOffset
+	case off < int(s.released.Load()):
+		return nil, ErrReleased
+	case off == size:
+		return nil, nil
+	}
+	i, o := off/s.segSize, off%s.segSize
+	end := s.segSize
+	if (i+1)*s.segSize > size {
+		end = size - i*s.segSize
+	}
+	return segs[i][o:end], nil
+}
+
+func (s *segmentStore) bytesFrom(off int) []byte {
+	var b []byte
+	for {
+		p, err := s.peek(off)
+		if err != nil || len(p) == 0 {
+			return b
+		}
+		b = append(b, p...)
+		off += len(p)
+	}
+}
+
+// segmentedBuffer is a RepeatableBuffer backed by a segmentStore. It reads
+// through its own fork, so the buffer and its forks share one code path.
+type segmentedBuffer struct {
+	*repeatableBufferFork
+	store *segmentStore
+}
+
+// NewSegmentedBuffer returns a buffer storing its contents in segments of
+// segmentSize bytes. If pool is non-nil, segments are taken from it and
+// handed back on Release.
+func NewSegmentedBuffer(segmentSize int, pool BufferPool) *segmentedBuffer {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	store := newSegmentStore(segmentSize, pool)
+	return &segmentedBuffer{
+		repeatableBufferFork: newRepeatableBufferFork(store, 0),
+		store:                store,
+	}
+}
+
+// Write appends the contents of p to the buffer; err is always nil.
+func (sb *segmentedBuffer) Write(p []byte) (n int, err error) {
+	s := sb.store
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	for len(p) > 0 {
+		m := copy(s.tail(), p)
+		s.size.Add(int64(m))
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// FillFrom performs a single Read from r into the unused space of the last
+// segment, requesting at most size bytes. Readers only observe the new
+// bytes once the Read returned.
+func (sb *segmentedBuffer) FillFrom(r io.Reader, size int) (n int, err error) {
+	s := sb.store
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	tail := s.tail()
+	if len(tail) > size {
+		tail = tail[:size]
+	}
+	n, err = r.Read(tail)
+	if n < 0 {
+		panic(errNegativeRead)
+	}
+	s.size.Add(int64(n))
+	return n, err
+}
+
+// Release frees all segments lying entirely below off. Reading released
+// bytes fails with ErrReleased afterwards, so callers must only release
+// data no buffer, fork or pending WriteTo is still consuming.
+func (sb *segmentedBuffer) Release(off int) {
+	s := sb.store
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if size := int(s.size.Load()); off > size {
+		off = size
+	}
+	released := int(s.released.Load())
+	end := off / s.segSize * s.segSize
+	if end <= released {
+		return
+	}
+	segs := append([][]byte(nil), *s.segs.Load()...)
+	for i := released / s.segSize; i < end/s.segSize; i++ {
+		if s.pool != nil {
+			s.pool.Put(segs[i])
+		}
+		segs[i] = nil
+	}
+	s.released.Store(int64(end))
+	s.segs.Store(&segs)
+}
@@ -0,0 +1,77 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("segmentedBuffer", func() {
+	readall := func(r io.Reader) string {
+		buf, err := io.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		return string(buf)
+	}
+
+	It("writes spanning multiple segments are read back intact", func() {
+		sb := NewSegmentedBuffer(16, nil)
+		data := RandomString(100)
+		sb.Write([]byte(data[:7]))
+		sb.Write([]byte(data[7:]))
+		Expect(*sb.store.segs.Load()).To(HaveLen(7))
+
+		fork := sb.Fork()
+		Expect(readall(sb)).To(Equal(data))
+		Expect(fork.String()).To(Equal(data))
+		Expect(readall(fork)).To(Equal(data))
+
+		at, err := sb.ForkAt(50)
+		Expect(err).ToNot(HaveOccurred())
+		var dst bytes.Buffer
+		_, err = at.WriteTo(&dst)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dst.String()).To(Equal(data[50:]))
+	})
+
+	It("appending never moves existing segments", func() {
+		sb := NewSegmentedBuffer(16, nil)
+		sb.Write([]byte(RandomString(16)))
+		first := (*sb.store.segs.Load())[0]
+		sb.Write([]byte(RandomString(1024)))
+		Expect(&(*sb.store.segs.Load())[0][0]).To(BeIdenticalTo(&first[0]))
+	})
+
+	It("fills directly from a reader", func() {
+		sb := NewSegmentedBuffer(16, nil)
+		src := bytes.NewReader([]byte("0123456789abcdefghij"))
+		n, err := sb.FillFrom(src, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(16))
+		n, err = sb.FillFrom(src, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(sb.String()).To(Equal("0123456789abcdefgh"))
+	})
+
+	It("released segments are handed back and no longer readable", func() {
+		p := &testPool{}
+		sb := NewSegmentedBuffer(16, p)
+		sb.Write([]byte(RandomString(40)))
+		fork := sb.Fork()
+
+		sb.Release(20)
+		Expect(p.puts).To(Equal(1))
+		Expect((*sb.store.segs.Load())[0]).To(BeNil())
+
+		_, err := fork.Read(make([]byte, 8))
+		Expect(err).To(Equal(ErrReleased))
+		_, err = sb.ForkAt(8)
+		Expect(err).To(Equal(ErrReleased))
+
+		at, err := sb.ForkAt(16)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readall(at)).To(HaveLen(24))
+	})
+})
@@ -0,0 +1,106 @@
+package buffer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SinkErrorPolicy decides what happens to the stream when writing to a
+// sink fails.
+type SinkErrorPolicy int
+
+const (
+	// SinkDrop detaches the failing sink and keeps the stream going.
+	SinkDrop SinkErrorPolicy = iota
+	// SinkFailStream fails the stream, so every fork sees the sink's error.
+	SinkFailStream
+)
+
+type sink struct {
+	w      io.Writer
+	policy SinkErrorPolicy
+}
+
+// sinks tees the bytes pulled from the source to external writers.
+type sinks struct {
+	mu      sync.Mutex
+	list    []sink
+	written int // bytes already handed to every sink in list
+}
+
+// AddSink registers w to receive every byte pulled from the source. Bytes
+// pulled before the call are written to w first, so the sink always sees
+// the stream from its beginning. If that catch-up write fails, w is not
+// registered and the error is returned.
+func (sw *streamWrapper) AddSink(w io.Writer, policy SinkErrorPolicy) error {
+	s := &sw.sinks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := sw.writeRange(w, 0, s.written); err != nil {
+		return err
+	}
+	s.list = append(s.list, sink{w: w, policy: policy})
+	return nil
+}
+
+// writeSinks hands the n bytes just pulled from the source to all sinks. It
+// returns an error if a sink with SinkFailStream policy failed.
+func (sw *streamWrapper) writeSinks(n int) error {
+	s := &sw.sinks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	off := s.written
+	s.written += n
+	if n == 0 || len(s.list) == 0 {
+		return nil
+	}
+
+	var ferr error
+	kept := s.list[:0]
+	for _, sk := range s.list {
+		err := sw.writeRange(sk.w, off, n)
+		if err == nil {
+			kept = append(kept, sk)
+			continue
+		}
+		if sk.policy == SinkFailStream && ferr == nil {
+			ferr = fmt.Errorf("buffer: write to sink: %w", err)
+		}
+	}
+	s.list = kept
+	return ferr
+}
+
+// writeRange writes the n buffered bytes starting at off to w, straight
+// from the shared buffer.
+func (sw *streamWrapper) writeRange(w io.Writer, off, n int) error {
+	fork, err := sw.buf.ForkAt(off)
+	if err != nil {
+		return err
+	}
+	for n > 0 {
+		p, err := fork.origin.peek(fork.off)
+		if err != nil {
+			return err
+		}
+		if len(p) == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if len(p) > n {
+			p = p[:n]
+		}
+		m, err := w.Write(p)
+		if err != nil {
+			return err
+		}
+		if m != len(p) {
+			return io.ErrShortWrite
+		}
+		fork.off += m
+		n -= m
+	}
+	return nil
+}
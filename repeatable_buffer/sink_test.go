@@ -0,0 +1,77 @@
+package buffer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type failingWriter struct {
+	after int
+}
+
+var errSinkFull = errors.New("sink full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.after < len(p) {
+		return 0, errSinkFull
+	}
+	w.after -= len(p)
+	return len(p), nil
+}
+
+var _ = Describe("sinks", func() {
+	data := RandomString(64 * 1024)
+
+	It("sinks receive every byte pulled, including those pulled before registering", func() {
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader([]byte(data)), nil)
+		_, err := wrapper.Read(make([]byte, 100))
+		Expect(err).ToNot(HaveOccurred())
+
+		var file bytes.Buffer
+		h := sha256.New()
+		Expect(wrapper.AddSink(&file, SinkFailStream)).To(Succeed())
+		Expect(wrapper.AddSink(h, SinkDrop)).To(Succeed())
+
+		_, err = io.Copy(io.Discard, wrapper)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(file.String()).To(Equal(data))
+		sum := sha256.Sum256([]byte(data))
+		Expect(h.Sum(nil)).To(Equal(sum[:]))
+	})
+
+	It("failing sink with drop policy is detached", func() {
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader([]byte(data)), nil, WithChunkSize(4096))
+		Expect(wrapper.AddSink(&failingWriter{after: 8192}, SinkDrop)).To(Succeed())
+
+		b, err := io.ReadAll(wrapper)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal(data))
+		Expect(wrapper.sinks.list).To(BeEmpty())
+	})
+
+	It("failing sink with fail policy fails all forks", func() {
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader([]byte(data)), nil, WithChunkSize(4096))
+		fork := wrapper.Fork()
+		Expect(wrapper.AddSink(&failingWriter{after: 8192}, SinkFailStream)).To(Succeed())
+
+		_, err := io.ReadAll(wrapper)
+		Expect(err).To(MatchError(errSinkFull))
+		_, err = io.ReadAll(fork)
+		Expect(err).To(MatchError(errSinkFull))
+	})
+	It("failing sink fails the stream when the last bytes come with io.EOF", func() {
+		wrapper := NewRepeatableStreamWrapper(iotest.DataErrReader(strings.NewReader("hello")), nil)
+		Expect(wrapper.AddSink(&failingWriter{}, SinkFailStream)).To(Succeed())
+
+		_, err := io.ReadAll(wrapper)
+		Expect(err).To(MatchError(errSinkFull))
+		Expect(wrapper.Completed()).To(BeFalse())
+	})
+})
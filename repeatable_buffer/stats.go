@@ -0,0 +1,59 @@
+package buffer
+
+import "io"
+
+// Progress is reported to the WithProgress callback after every pull from
+// the source.
+type Progress struct {
+	Pulled   int64 // bytes pulled from the source so far
+	Expected int64 // total length of the source, or -1 if unknown
+	Done     bool  // the source is exhausted or failed
+}
+
+// Stats is a snapshot of a stream's byte accounting.
+type Stats struct {
+	Progress
+	Forks     int                          // number of live forks, including the wrapper's own
+	Delivered map[*streamWrapperFork]int64 // bytes handed out by each live fork
+	Err       error                        // io.EOF after a complete source, nil while in progress
+}
+
+// WithProgress calls fn after every pull from the source, on the goroutine
+// doing the pull; fn must not block.
+func WithProgress(fn func(Progress)) StreamWrapperOption {
+	return func(sw *streamWrapper) {
+		sw.onProgress = fn
+	}
+}
+
+func (sw *streamWrapper) Stats() Stats {
+	err := sw.err()
+	st := Stats{
+		Progress: Progress{
+			Pulled:   sw.size.Load(),
+			Expected: sw.expectedLen,
+			Done:     err != nil,
+		},
+		Err: err,
+	}
+
+	sw.forksMu.Lock()
+	defer sw.forksMu.Unlock()
+
+	st.Forks = len(sw.forks)
+	st.Delivered = make(map[*streamWrapperFork]int64, len(sw.forks))
+	for swf := range sw.forks {
+		st.Delivered[swf] = swf.Delivered()
+	}
+	return st
+}
+
+// Completed reports whether the whole source was read successfully.
+func (sw *streamWrapper) Completed() bool {
+	return sw.err() == io.EOF
+}
+
+// Delivered returns the number of bytes this fork handed out so far.
+func (swf *streamWrapperFork) Delivered() int64 {
+	return swf.delivered.Load()
+}
@@ -0,0 +1,52 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("stats", func() {
+	data := []byte(RandomString(10000))
+
+	It("accounts pulled and delivered bytes", func() {
+		var reports []Progress
+		wrapper := NewRepeatableStreamWrapper(bytes.NewReader(data), nil,
+			WithExpectedLength(int64(len(data))),
+			WithProgress(func(p Progress) { reports = append(reports, p) }))
+		fork := wrapper.Fork()
+
+		st := wrapper.Stats()
+		Expect(st.Pulled).To(BeZero())
+		Expect(st.Expected).To(Equal(int64(len(data))))
+		Expect(st.Forks).To(Equal(2))
+		Expect(st.Done).To(BeFalse())
+
+		_, err := io.ReadFull(fork, make([]byte, 100))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fork.Delivered()).To(Equal(int64(100)))
+
+		_, err = io.Copy(io.Discard, wrapper)
+		Expect(err).ToNot(HaveOccurred())
+
+		st = wrapper.Stats()
+		Expect(st.Pulled).To(Equal(int64(len(data))))
+		Expect(st.Done).To(BeTrue())
+		Expect(st.Err).To(Equal(io.EOF))
+		Expect(st.Delivered).To(HaveLen(2))
+		Expect(st.Delivered).To(HaveKeyWithValue(fork, int64(100)))
+		Expect(st.Delivered).To(HaveKeyWithValue(wrapper.fork, int64(len(data))))
+		Expect(wrapper.Completed()).To(BeTrue())
+
+		Expect(reports).ToNot(BeEmpty())
+		last := reports[len(reports)-1]
+		Expect(last).To(Equal(Progress{Pulled: int64(len(data)), Expected: int64(len(data)), Done: true}))
+
+		fork.Close()
+		st = wrapper.Stats()
+		Expect(st.Forks).To(Equal(1))
+		Expect(st.Delivered).ToNot(HaveKey(fork))
+	})
+})
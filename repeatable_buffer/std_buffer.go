@@ -81,6 +81,29 @@ func (b *Buffer) String() string {
 	return string(b.buf[b.off:])
 }
 
+func (b *Buffer) peek(off int) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if off > len(b.buf) {
+		return nil, ErrInvalidOffset
+	}
+	return b.buf[off:], nil
+}
+
+func (b *Buffer) bytesFrom(off int) []byte {
+	p, _ := b.peek(off)
+	return p
+}
+
+// Offset returns the read offset, that is the number of bytes read so far.
+func (b *Buffer) Offset() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.off
+}
+
 // empty reports whether the unread portion of the buffer is empty.
 func (b *Buffer) empty() bool { return len(b.buf) <= b.off }
 
@@ -190,6 +213,55 @@ func (b *Buffer) Write(p []byte) (n int, err error) {
 	return copy(b.buf[m:], p), nil
 }
 
+// FillFrom performs a single Read of at most size bytes from r directly
+// into the buffer's unused capacity. The buffer only grows once it is
+// full and r still has data, so a buffer preallocated for the whole source
+// is never copied. The lock is not held during the Read, so concurrent
+// readers only observe the new bytes once it returns. FillFrom must not be
+// called concurrently with itself or with Write.
+func (b *Buffer) FillFrom(r io.Reader, size int) (n int, err error) {
+	b.mu.Lock()
+	b.lastRead = opInvalid
+	switch avail := b.Available(); {
+	case avail == 0 && len(b.buf) > 0:
+		b.mu.Unlock()
+		return b.fillFull(r)
+	case avail == 0:
+		// nothing to copy yet
+		m := b.grow(size)
+		b.buf = b.buf[:m]
+	case avail < size:
+		size = avail
+	}
+	l := len(b.buf)
+	tail := b.buf[l : l+size]
+	b.mu.Unlock()
+
+	n, err = r.Read(tail)
+	if n < 0 {
+		panic(errNegativeRead)
+	}
+
+	b.mu.Lock()
+	b.buf = b.buf[:l+n]
+	b.mu.Unlock()
+	return n, err
+}
+
+// fillFull reads up to MinRead bytes into a scratch array first, so that a
+// full buffer is only grown if r turns out not to be drained yet.
+func (b *Buffer) fillFull(r io.Reader) (n int, err error) {
+	var probe [MinRead]byte
+	n, err = r.Read(probe[:])
+	if n < 0 {
+		panic(errNegativeRead)
+	}
+	if n > 0 {
+		b.Write(probe[:n])
+	}
+	return n, err
+}
+
 // MinRead is the minimum slice size passed to a Read call by
 // Buffer.ReadFrom. As long as the Buffer has at least MinRead bytes beyond
 // what is required to hold the contents of r, ReadFrom will not grow the
@@ -228,8 +300,8 @@ func growSlice(b []byte, n int) []byte {
 // buffer has no data to return, err is io.EOF (unless len(p) is zero);
 // otherwise it is nil.
 func (b *Buffer) Read(p []byte) (n int, err error) {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
 	b.lastRead = opInvalid
 	if b.empty() {
@@ -250,6 +322,40 @@ func (b *Buffer) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// WriteTo writes data to w until the buffer is drained or an error occurs.
+// The return value n is the number of bytes written; it always fits into an
+// int, but it is int64 to match the io.WriterTo interface. Any error
+// encountered during the write is also returned.
+func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	b.mu.RLock()
+	p := b.buf[b.off:]
+	b.mu.RUnlock()
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+	m, e := w.Write(p)
+	if m > len(p) {
+		panic("bytes.Buffer.WriteTo: invalid Write count")
+	}
+
+	b.mu.Lock()
+	b.off += m
+	b.lastRead = opInvalid
+	b.mu.Unlock()
+
+	n = int64(m)
+	if e != nil {
+		return n, e
+	}
+	// all bytes should have been written, by definition of
+	// Write method in io.Writer
+	if m != len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
 // NewBuffer creates and initializes a new Buffer using buf as its
 // initial contents. The new Buffer takes ownership of buf, and the
 // caller should not use buf after this call. NewBuffer is intended to
@@ -2,15 +2,28 @@ package buffer
 
 import (
 	"context"
+	"errors"
 	"io"
+	"os"
+	"sync"
 	"sync/atomic"
+	"time"
+)
 
-	"github.com/nadoo/glider/pkg/pool"
+const (
+	minReadChunkSize = 4096
+	maxReadChunkSize = 1 << 20
 )
 
+// ErrLengthExceeded is returned to every fork if the source yields more
+// bytes than the expected length.
+var ErrLengthExceeded = errors.New("buffer: source longer than expected length")
+
 type RepeatableStreamWrapper interface {
 	Read(p []byte) (n int, err error)
 	Fork() *streamWrapperFork
+	ForkFromCurrent() *streamWrapperFork
+	ForkAt(off int) (*streamWrapperFork, error)
 	Close() error
 }
 
@@ -18,74 +31,291 @@ var (
 	_ RepeatableStreamWrapper = (*streamWrapper)(nil)
 	_ RepeatableStreamWrapper = (*streamWrapperFork)(nil)
 	_ io.ReadCloser           = (*streamWrapperFork)(nil)
+	_ io.WriterTo             = (*streamWrapperFork)(nil)
 )
 
 type streamWrapper struct {
-	r     io.Reader
-	buf   RepeatableBuffer
-	fork  *streamWrapperFork
-	onEOF func(io.Reader, error)
+	buf        RepeatableBuffer
+	fork       *streamWrapperFork
+	onComplete func(Completion)
+	started    time.Time
 
-	rerr   atomic.Value
+	srcMu     sync.Mutex // guards r and srcClosed
+	r         io.Reader
+	srcClosed bool
+
+	rerr   atomic.Pointer[error] // sticky error, set once
 	hasErr chan struct{}
 
-	tryReadCh   chan struct{}
-	broadcaster simpleBroadcaster
-	children    atomic.Int32
+	pool         BufferPool
+	sizeHint     int
+	segmentSize  int
+	minChunkSize int
+	maxChunkSize int
+	digests      []digest
+	expectedLen  int64
+	resume       ResumeFunc
+	limiter      atomic.Pointer[Limiter]
+	onProgress   func(Progress)
+
+	throttleMu   sync.Mutex         // guards stopThrottle
+	stopThrottle context.CancelFunc // ends the source limiter wait in progress
+
+	// chunkSize is only accessed by the goroutine holding tryReadCh
+	chunkSize int
+	tryReadCh chan struct{}
+	notifier  notifier
+	sinks     sinks
+	size      atomic.Int64
+	children  atomic.Int32
+
+	forksMu sync.Mutex
+	forks   map[*streamWrapperFork]struct{} // live forks
 }
 
-func NewRepeatableStreamWrapper(r io.Reader, onEOF func(io.Reader, error)) *streamWrapper {
+// NewRepeatableStreamWrapper wraps r so it can be read by any number of
+// forks. onComplete, if non-nil, is called once the stream ends for any
+// reason; by then r has been closed if it is an io.Closer.
+func NewRepeatableStreamWrapper(r io.Reader, onComplete func(Completion), opts ...StreamWrapperOption) *streamWrapper {
 	sw := &streamWrapper{
-		r:         r,
-		buf:       NewRepeatableBuffer(),
-		onEOF:     onEOF,
-		hasErr:    make(chan struct{}),
-		tryReadCh: make(chan struct{}, 1),
+		r:            r,
+		onComplete:   onComplete,
+		started:      time.Now(),
+		hasErr:       make(chan struct{}),
+		minChunkSize: minReadChunkSize,
+		maxChunkSize: maxReadChunkSize,
+		expectedLen:  -1,
+		tryReadCh:    make(chan struct{}, 1),
+		forks:        make(map[*streamWrapperFork]struct{}),
+	}
+	for _, opt := range opts {
+		opt(sw)
+	}
+	if sw.segmentSize > 0 {
+		sw.buf = NewSegmentedBuffer(sw.segmentSize, sw.pool)
+	} else {
+		sw.buf = NewRepeatableBufferSize(sw.sizeHint)
 	}
+	for _, d := range sw.digests {
+		sw.sinks.list = append(sw.sinks.list, sink{w: d.h, policy: SinkFailStream})
+	}
+	sw.chunkSize = sw.minChunkSize
 	sw.fork = sw.Fork()
 	return sw
 }
 
-func (sw *streamWrapper) setError(err error) {
-	if sw.rerr.CompareAndSwap(nil, err) {
-		close(sw.hasErr)
-		sw.broadcaster.CloseAll()
+// err returns the sticky stream error, or nil while the source is readable.
+func (sw *streamWrapper) err() error {
+	if p := sw.rerr.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// finish makes err the sticky stream error, wakes up all forks, closes the
+// source and reports the completion. Only the first call has any effect.
+func (sw *streamWrapper) finish(cause CompletionCause, err error) {
+	if !sw.rerr.CompareAndSwap(nil, &err) {
+		return
+	}
+	close(sw.hasErr)
+	sw.interruptThrottle()
+	sw.notifier.CloseAll()
+	sw.closeSource()
+	if sw.onComplete != nil {
+		sw.onComplete(Completion{
+			Cause:    cause,
+			Err:      err,
+			Bytes:    sw.size.Load(),
+			Duration: time.Since(sw.started),
+			Data:     sw.buf.Fork(),
+		})
 	}
 }
 
 func (sw *streamWrapper) doRead() {
-	if err := sw.rerr.Load(); err != nil {
+	if sw.err() != nil {
 		return
 	}
-	p := pool.GetBuffer(4096)
-	defer pool.PutBuffer(p)
-	n, err := sw.r.Read(p)
+	n, err := sw.fill()
+	size := sw.size.Add(int64(n))
+	if err != nil && err != io.EOF && sw.resume != nil && sw.err() == nil {
+		if r, rerr := sw.resume(size, err); rerr == nil {
+			sw.replaceSource(r)
+			err = nil
+		}
+	}
+	sw.adaptChunkSize(n)
+	// a sink failing on the last bytes fails the stream even if the
+	// source returned them together with io.EOF
+	if serr := sw.writeSinks(n); serr != nil && (err == nil || err == io.EOF) {
+		err = serr
+	}
+	if err == io.EOF {
+		if verr := sw.verify(size); verr != nil {
+			err = verr
+		}
+	}
+	if err == io.EOF {
+		sw.finish(CompletedEOF, err)
+	} else if err != nil {
+		sw.finish(CompletedError, err)
+	}
+	sw.notifier.Notify(int(size))
+	if sw.onProgress != nil {
+		sw.onProgress(Progress{Pulled: size, Expected: sw.expectedLen, Done: err != nil})
+	}
+}
+
+// verify checks the complete source against the expected length and
+// digests, once it reached io.EOF after size bytes.
+func (sw *streamWrapper) verify(size int64) error {
+	if sw.expectedLen >= 0 {
+		if size < sw.expectedLen {
+			return io.ErrUnexpectedEOF
+		}
+		if size > sw.expectedLen {
+			return ErrLengthExceeded
+		}
+	}
+	return sw.verifyDigests()
+}
+
+func (sw *streamWrapper) fill() (n int, err error) {
+	r := sw.source()
+	size := sw.chunkSize
+	l := sw.limiter.Load()
+	if l != nil {
+		if burst := l.Burst(); burst > 0 && burst < size {
+			size = burst
+		}
+		defer func() {
+			sw.throttle(l, n)
+		}()
+	}
+
+	if sw.pool == nil || sw.segmentSize > 0 {
+		return sw.buf.FillFrom(r, size)
+	}
+	p := sw.pool.Get(size)
+	defer sw.pool.Put(p)
+	n, err = r.Read(p)
 	sw.buf.Write(p[:n])
-	if err != nil {
-		sw.setError(err)
-		if sw.onEOF != nil {
-			sw.onEOF(sw.buf, sw.rerr.Load().(error))
+	return n, err
+}
+
+// throttle waits for l to admit n pulled bytes. The wait ends early once
+// the stream finishes or the source limiter is replaced.
+func (sw *streamWrapper) throttle(l *Limiter, n int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sw.throttleMu.Lock()
+	sw.stopThrottle = cancel
+	sw.throttleMu.Unlock()
+	defer func() {
+		sw.throttleMu.Lock()
+		sw.stopThrottle = nil
+		sw.throttleMu.Unlock()
+	}()
+
+	// finish or SetSourceLimiter may have run before stopThrottle was set
+	select {
+	case <-sw.hasErr:
+		return
+	default:
+	}
+	if sw.limiter.Load() != l {
+		return
+	}
+	l.WaitN(ctx, n)
+}
+
+func (sw *streamWrapper) interruptThrottle() {
+	sw.throttleMu.Lock()
+	defer sw.throttleMu.Unlock()
+	if sw.stopThrottle != nil {
+		sw.stopThrottle()
+	}
+}
+
+// SetSourceLimiter limits how fast the source is pulled, independent of
+// how fast forks consume it; nil removes the limit. A pull already waiting
+// on the previous limiter is released.
+func (sw *streamWrapper) SetSourceLimiter(l *Limiter) {
+	sw.limiter.Store(l)
+	sw.interruptThrottle()
+}
+
+// adaptChunkSize doubles the read size while the source keeps filling it,
+// and shrinks it again once reads come back much shorter.
+func (sw *streamWrapper) adaptChunkSize(n int) {
+	switch {
+	case n >= sw.chunkSize && sw.chunkSize < sw.maxChunkSize:
+		sw.chunkSize *= 2
+		if sw.chunkSize > sw.maxChunkSize {
+			sw.chunkSize = sw.maxChunkSize
+		}
+	case n < sw.chunkSize/4 && sw.chunkSize > sw.minChunkSize:
+		sw.chunkSize /= 2
+		if sw.chunkSize < sw.minChunkSize {
+			sw.chunkSize = sw.minChunkSize
 		}
 	}
-	sw.broadcaster.Notify()
 }
 
 func (sw *streamWrapper) Read(p []byte) (int, error) {
 	return sw.fork.Read(p)
 }
 
+func (sw *streamWrapper) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return sw.fork.ReadContext(ctx, p)
+}
+
+func (sw *streamWrapper) SetReadDeadline(t time.Time) error {
+	return sw.fork.SetReadDeadline(t)
+}
+
+func (sw *streamWrapper) WriteTo(w io.Writer) (int64, error) {
+	return sw.fork.WriteTo(w)
+}
+
 func (sw *streamWrapper) Fork() *streamWrapperFork {
+	return sw.newFork(sw.buf.Fork())
+}
+
+// ForkFromCurrent returns a fork continuing from the wrapper's current
+// read offset, e.g. after headers and part of the body were already sent.
+func (sw *streamWrapper) ForkFromCurrent() *streamWrapperFork {
+	return sw.fork.ForkFromCurrent()
+}
+
+// ForkAt returns a fork starting at the absolute offset off, which must
+// already be buffered.
+func (sw *streamWrapper) ForkAt(off int) (*streamWrapperFork, error) {
+	buf, err := sw.buf.ForkAt(off)
+	if err != nil {
+		return nil, err
+	}
+	return sw.newFork(buf), nil
+}
+
+func (sw *streamWrapper) newFork(buf RepeatableBufferReader) *streamWrapperFork {
 	sw.children.Add(1)
-	return &streamWrapperFork{
+	swf := &streamWrapperFork{
 		origin:        sw,
-		buf:           sw.buf.Fork(),
-		canRead:       sw.broadcaster.Register(),
+		buf:           buf,
+		sub:           sw.notifier.Register(),
 		localClosedCh: make(chan struct{}),
+		readDeadline:  makeDeadline(),
 	}
+	sw.forksMu.Lock()
+	sw.forks[swf] = struct{}{}
+	sw.forksMu.Unlock()
+	return swf
 }
 
 func (sw *streamWrapper) cancel() error {
-	sw.setError(context.Canceled)
+	sw.finish(CompletedCanceled, context.Canceled)
 	return nil
 }
 
@@ -97,14 +327,31 @@ func (sw *streamWrapper) Close() error {
 type streamWrapperFork struct {
 	origin *streamWrapper
 
-	buf     RepeatableBufferReader
-	canRead <-chan struct{}
+	buf RepeatableBufferReader
+	sub *subscription
 
 	localClosed   atomic.Bool
 	localClosedCh chan struct{}
+
+	readDeadline deadline
+	limiter      atomic.Pointer[Limiter]
+	delivered    atomic.Int64
 }
 
 func (swf *streamWrapperFork) Read(p []byte) (n int, err error) {
+	return swf.ReadContext(context.Background(), p)
+}
+
+// ReadContext is like Read but gives up waiting for the shared source once
+// ctx is done, returning ctx.Err(). Other forks are not affected, and a pull
+// from the source already in progress keeps going for them.
+func (swf *streamWrapperFork) ReadContext(ctx context.Context, p []byte) (n int, err error) {
+	n, err = swf.readContext(ctx, p)
+	swf.delivered.Add(int64(n))
+	return n, err
+}
+
+func (swf *streamWrapperFork) readContext(ctx context.Context, p []byte) (n int, err error) {
 	if p == nil {
 		return 0, nil
 	}
@@ -112,35 +359,171 @@ func (swf *streamWrapperFork) Read(p []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
+	l := swf.limiter.Load()
+	if l != nil {
+		if burst := l.Burst(); burst > 0 && burst < len(p) {
+			p = p[:burst]
+		}
+	}
+
 	origin := swf.origin
 	for {
-		n, _ = swf.buf.Read(p)
+		n, err = swf.buf.Read(p)
 		if n > 0 {
-			return n, nil
+			return n, swf.throttle(ctx, l, n)
 		}
-		if rerr := origin.rerr.Load(); rerr != nil {
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if rerr := origin.err(); rerr != nil {
 			n2, err := swf.buf.Read(p)
 			if err == nil {
 				return n2, nil
 			}
-			return n2, rerr.(error)
-		}
-		select {
-		case <-swf.localClosedCh:
-			return 0, io.EOF
-		case origin.tryReadCh <- struct{}{}:
-			origin.doRead()
-			<-origin.tryReadCh
-			continue
-		case <-swf.canRead:
+			return n2, rerr
+		}
+		if err := swf.wait(ctx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// WriteTo writes buffered bytes to w straight from the shared buffer,
+// pulling from the source as needed until it is exhausted.
+func (swf *streamWrapperFork) WriteTo(w io.Writer) (n int64, err error) {
+	if swf.localClosed.Load() {
+		return 0, nil
+	}
+	if swf.limiter.Load() != nil {
+		// go through Read, which hands out at most a burst at a time
+		return io.Copy(w, struct{ io.Reader }{swf})
+	}
+	defer func() {
+		swf.delivered.Add(n)
+	}()
+
+	origin := swf.origin
+	for {
+		m, err := swf.buf.WriteTo(w)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m > 0 {
 			continue
 		}
+		if rerr := origin.err(); rerr != nil {
+			m, err = swf.buf.WriteTo(w)
+			n += m
+			if err != nil {
+				return n, err
+			}
+			if rerr == io.EOF {
+				return n, nil
+			}
+			return n, rerr
+		}
+		if err := swf.wait(context.Background()); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+	}
+}
+
+// SetLimiter limits how fast this fork hands out bytes; nil removes the
+// limit. Sharing a Limiter between forks limits their combined rate.
+func (swf *streamWrapperFork) SetLimiter(l *Limiter) {
+	swf.limiter.Store(l)
+}
+
+// throttle delays handing out n bytes as required by l.
+func (swf *streamWrapperFork) throttle(ctx context.Context, l *Limiter, n int) error {
+	if l == nil {
+		return nil
+	}
+	d := l.Reserve(n)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-swf.localClosedCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-swf.readDeadline.wait():
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future and pending Read calls on
+// this fork; a zero value disables it. Reads failing due to the deadline
+// return os.ErrDeadlineExceeded.
+func (swf *streamWrapperFork) SetReadDeadline(t time.Time) error {
+	swf.readDeadline.set(t)
+	return nil
+}
+
+// wait blocks until new data may be available, either by pulling from the
+// source itself or by being notified by the fork that did. It returns io.EOF
+// if the fork was closed meanwhile.
+func (swf *streamWrapperFork) wait(ctx context.Context) error {
+	origin := swf.origin
+	select {
+	case <-swf.localClosedCh:
+		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-swf.readDeadline.wait():
+		return os.ErrDeadlineExceeded
+	case origin.tryReadCh <- struct{}{}:
+		return swf.pull(ctx)
+	case <-swf.sub.WaitLength(swf.buf.Offset() + 1):
+	}
+	return nil
+}
+
+// pull reads from the source on behalf of all forks. If the wait can be
+// interrupted, the read runs in its own goroutine so that abandoning it
+// does not stall the other forks.
+func (swf *streamWrapperFork) pull(ctx context.Context) error {
+	origin := swf.origin
+	if ctx.Done() == nil && !swf.readDeadline.isSet() {
+		origin.doRead()
+		<-origin.tryReadCh
+		return nil
+	}
+
+	pulled := make(chan struct{})
+	go func() {
+		defer close(pulled)
+		origin.doRead()
+		<-origin.tryReadCh
+	}()
+	select {
+	case <-pulled:
+		return nil
+	case <-swf.localClosedCh:
+		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-swf.readDeadline.wait():
+		return os.ErrDeadlineExceeded
 	}
 }
 
 func (swf *streamWrapperFork) Close() error {
 	if ok := swf.localClosed.CompareAndSwap(false, true); ok {
 		close(swf.localClosedCh)
+		swf.origin.notifier.Unregister(swf.sub)
+		swf.origin.forksMu.Lock()
+		delete(swf.origin.forks, swf)
+		swf.origin.forksMu.Unlock()
 		if new := swf.origin.children.Add(-1); new == 0 {
 			swf.origin.cancel()
 		}
@@ -151,3 +534,11 @@ func (swf *streamWrapperFork) Close() error {
 func (swf *streamWrapperFork) Fork() *streamWrapperFork {
 	return swf.origin.Fork()
 }
+
+func (swf *streamWrapperFork) ForkFromCurrent() *streamWrapperFork {
+	return swf.origin.newFork(swf.buf.ForkFromCurrent())
+}
+
+func (swf *streamWrapperFork) ForkAt(off int) (*streamWrapperFork, error) {
+	return swf.origin.ForkAt(off)
+}
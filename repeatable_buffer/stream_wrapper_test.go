@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	crand "crypto/rand"
+	"errors"
 	"io"
 	"math/rand"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"strings"
 	"sync"
+	"testing/iotest"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -31,13 +35,13 @@ func newTestRwc() *testRwc {
 
 func (rwc *testRwc) Read(p []byte) (int, error) {
 	for {
+		rwc.mu.Lock()
 		n, _ := rwc.buf.Read(p)
+		closed := rwc.closed
+		rwc.mu.Unlock()
 		if n > 0 {
 			return n, nil
 		}
-		rwc.mu.Lock()
-		closed := rwc.closed
-		rwc.mu.Unlock()
 		if closed {
 			return 0, io.EOF
 		}
@@ -52,6 +56,8 @@ func (rwc *testRwc) Write(p []byte) (int, error) {
 		default:
 		}
 	}()
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
 	return rwc.buf.Write(p)
 }
 
@@ -59,11 +65,26 @@ func (rwc *testRwc) Close() error {
 	rwc.mu.Lock()
 	defer rwc.mu.Unlock()
 
-	rwc.closed = true
-	close(rwc.canRead)
+	if !rwc.closed {
+		rwc.closed = true
+		close(rwc.canRead)
+	}
 	return nil
 }
 
+type testPool struct {
+	gets, puts int
+}
+
+func (p *testPool) Get(size int) []byte {
+	p.gets++
+	return make([]byte, size)
+}
+
+func (p *testPool) Put(buf []byte) {
+	p.puts++
+}
+
 var _ = Describe("streamWrapper", func() {
 	go func() {
 		_ = http.ListenAndServe("localhost:6060", nil)
@@ -90,6 +111,190 @@ var _ = Describe("streamWrapper", func() {
 		Expect(err).To(Equal(context.Canceled))
 	})
 
+	It("closed forks unregister from the notifier", func() {
+		for i := 0; i < 10; i++ {
+			wrapper.Fork().Close()
+		}
+		Expect(wrapper.notifier.subs).To(HaveLen(1))
+	})
+
+	It("fork from current position continues where parent stopped", func() {
+		source.Write([]byte("header|body"))
+		source.Close()
+
+		b := make([]byte, 7)
+		n, err := io.ReadFull(wrapper, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b[:n])).To(Equal("header|"))
+
+		rest, err := io.ReadAll(wrapper.ForkFromCurrent())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(rest)).To(Equal("body"))
+
+		fork, err := wrapper.ForkAt(2)
+		Expect(err).ToNot(HaveOccurred())
+		rest, err = io.ReadAll(fork)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(rest)).To(Equal("ader|body"))
+
+		_, err = wrapper.ForkAt(100)
+		Expect(err).To(Equal(ErrInvalidOffset))
+	})
+
+	It("fork copies to writer through WriteTo", func() {
+		data := RandomString(64 * 1024)
+		source.Write([]byte(data))
+		source.Close()
+
+		fork := wrapper.Fork()
+		var dst bytes.Buffer
+		n, err := io.Copy(&dst, fork)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(int64(len(data))))
+		Expect(dst.String()).To(Equal(data))
+
+		dst.Reset()
+		_, err = wrapper.WriteTo(&dst)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dst.String()).To(Equal(data))
+	})
+
+	It("read chunk size adapts to source", func() {
+		wrapper = NewRepeatableStreamWrapper(bytes.NewReader(make([]byte, 1<<20)), nil)
+		_, err := io.Copy(io.Discard, wrapper)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(wrapper.chunkSize).To(BeNumerically(">", minReadChunkSize))
+	})
+
+	Context("interruptible reads", func() {
+		It("canceled context abandons the wait without affecting other forks", func() {
+			fork := wrapper.Fork()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+			defer cancel()
+			_, err := fork.ReadContext(ctx, make([]byte, 16))
+			Expect(err).To(Equal(context.DeadlineExceeded))
+
+			source.Write([]byte("hello"))
+			source.Close()
+			b, err := io.ReadAll(wrapper)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("hello"))
+			b, err = io.ReadAll(fork)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("hello"))
+		})
+
+		It("read deadline fails pending and future reads until reset", func() {
+			fork := wrapper.Fork()
+			fork.SetReadDeadline(time.Now().Add(time.Millisecond * 20))
+			_, err := fork.Read(make([]byte, 16))
+			Expect(err).To(Equal(os.ErrDeadlineExceeded))
+			_, err = fork.Read(make([]byte, 16))
+			Expect(err).To(Equal(os.ErrDeadlineExceeded))
+
+			fork.SetReadDeadline(time.Time{})
+			source.Write([]byte("hello"))
+			source.Close()
+			b, err := io.ReadAll(fork)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("hello"))
+		})
+	})
+
+	Context("options", func() {
+		It("fixed chunk size never adapts", func() {
+			wrapper = NewRepeatableStreamWrapper(bytes.NewReader(make([]byte, 64*1024)), nil, WithChunkSize(1024))
+			_, err := io.Copy(io.Discard, wrapper)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(wrapper.chunkSize).To(Equal(1024))
+		})
+
+		It("adaptive chunk size stays within bounds", func() {
+			wrapper = NewRepeatableStreamWrapper(bytes.NewReader(make([]byte, 1<<20)), nil, WithAdaptiveChunkSize(512, 8192))
+			_, err := io.Copy(io.Discard, wrapper)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(wrapper.chunkSize).To(BeNumerically("<=", 8192))
+		})
+
+		It("reads through caller supplied buffer pool", func() {
+			data := RandomString(10000)
+			p := &testPool{}
+			wrapper = NewRepeatableStreamWrapper(bytes.NewReader([]byte(data)), nil, WithBufferPool(p))
+			b, err := io.ReadAll(wrapper)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal(data))
+			Expect(p.gets).To(BeNumerically(">", 0))
+			Expect(p.puts).To(Equal(p.gets))
+		})
+
+		It("segmented buffer serves forks like contiguous one", func() {
+			data := RandomString(100 * 1024)
+			wrapper = NewRepeatableStreamWrapper(bytes.NewReader([]byte(data)), nil, WithSegmentedBuffer(4096))
+			fork := wrapper.Fork()
+			b, err := io.ReadAll(wrapper)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal(data))
+
+			var dst bytes.Buffer
+			_, err = io.Copy(&dst, fork)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dst.String()).To(Equal(data))
+		})
+
+		It("expected length detects short and long sources", func() {
+			wrapper = NewRepeatableStreamWrapper(strings.NewReader("hello"), nil, WithExpectedLength(6))
+			_, err := io.ReadAll(wrapper)
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+
+			wrapper = NewRepeatableStreamWrapper(strings.NewReader("hello"), nil, WithExpectedLength(4))
+			_, err = io.ReadAll(wrapper)
+			Expect(err).To(Equal(ErrLengthExceeded))
+
+			wrapper = NewRepeatableStreamWrapper(strings.NewReader("hello"), nil, WithExpectedLength(5))
+			_, err = io.ReadAll(wrapper)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("failed source is resumed at the current offset", func() {
+			errBroken := errors.New("broken pipe")
+			data := "hello world"
+			var resumedAt []int64
+			resume := func(off int64, cause error) (io.Reader, error) {
+				Expect(cause).To(Equal(errBroken))
+				resumedAt = append(resumedAt, off)
+				if len(resumedAt) > 1 {
+					return nil, errors.New("give up")
+				}
+				return io.MultiReader(strings.NewReader(data[off:8]), iotest.ErrReader(errBroken)), nil
+			}
+			src := io.MultiReader(strings.NewReader(data[:5]), iotest.ErrReader(errBroken))
+			wrapper = NewRepeatableStreamWrapper(src, nil, WithResume(resume))
+			b, err := io.ReadAll(wrapper)
+			Expect(err).To(Equal(errBroken))
+			Expect(string(b)).To(Equal(data[:8]))
+			Expect(resumedAt).To(Equal([]int64{5, 8}))
+		})
+
+		It("size hint preallocates backing buffer", func() {
+			for _, hint := range []int{100000, 1 << 20} {
+				wrapper = NewRepeatableStreamWrapper(bytes.NewReader(make([]byte, hint)), nil, WithSizeHint(int64(hint)))
+				Expect(wrapper.buf.(*repeatableBufferImpl).Cap()).To(Equal(hint))
+				n, err := io.Copy(io.Discard, wrapper)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(int64(hint)))
+				Expect(wrapper.buf.(*repeatableBufferImpl).Cap()).To(Equal(hint))
+			}
+		})
+
+		It("buffer grows once the size hint is exceeded", func() {
+			data := RandomString(10000)
+			wrapper = NewRepeatableStreamWrapper(strings.NewReader(data), nil, WithSizeHint(4096))
+			b, err := io.ReadAll(wrapper)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal(data))
+		})
+	})
+
 	It("fuzzing test", func() {
 		wroteBytes := bytes.NewBuffer(nil)
 		N := 10